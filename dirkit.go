@@ -3,22 +3,87 @@
 // * A simple toolkit for folder and file handling that eliminates
 // boilerplate or wraps commonly used functions in a consistent
 // namespace for easy rememberance/importing.
+//
+// * Functions returning slices always return a nil slice alongside a
+// non-nil error.
 
 package dirkit
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
-var safetyPath string = "D:/safety/" // Change on per-project needs
+// The root that all "Safe" functions are restricted to. Defaults to "D:/safety/"
+// for backward compatibility, use SetSafetyPath to change on per-project needs.
+var safetyPath string = "D:/safety/"
+
+// How many times, and how far apart, DeleteSafeFile and DeleteSafeDirectory attempt
+// a delete that fails with a transient error. Defaults to a single attempt.
+var (
+	deleteRetryAttempts = 1
+	deleteRetryDelay    = time.Duration(0)
+)
+
+// Whether DeleteSafeFile and DeleteSafeDirectory make read-only files writable and
+// retry when a delete fails with a permission error, set with SetDeleteReadOnly.
+var deleteReadOnly = false
+
+// Receives an event at the end of operations such as copies and deletes, replaceable
+// with SetLogger. Defaults to a no-op.
+var logger func(op string, path string, err error) = func(string, string, error) {}
+
+// The source of the current time for GetDate and GetTime, replaceable with SetClock.
+var clock func() time.Time = time.Now
+
+// Returned when a write or copy would overwrite an existing file and overwriting was not allowed.
+var ErrDestExists = errors.New("destination already exists")
+
+// Returned when a file's contents could not be parsed as the expected json.
+var ErrInvalidJson = errors.New("invalid json")
+
+// Returned when a "Safe" function is given a path that is not within the safety path.
+var ErrOutsideSafetyPath = errors.New("outside safety path")
+
+// Returned when a joined or extracted path would escape its base directory.
+var ErrPathEscapes = errors.New("path escapes base directory")
+
+// Returned when HashFile is given an algorithm it does not support.
+var ErrUnsupportedAlgorithm = errors.New("unsupported hash algorithm")
+
+// Returned when a copied file's checksum does not match its source.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Returned when a directory has no files to choose from, such as by NewestFile.
+var ErrNoFiles = errors.New("directory has no files")
+
+// Returned when following symlinks leads back to a directory already being processed.
+var ErrSymlinkCycle = errors.New("symlink cycle detected")
+
+// Returned by a Walk callback to skip the directory being visited, or the
+// remaining files of the current directory when visiting a file.
+var SkipDir = filepath.SkipDir
 
 // Helper function for determining if a path exists on disk or not.
 // Args:
@@ -28,12 +93,38 @@ var safetyPath string = "D:/safety/" // Change on per-project needs
 // Returns:
 //
 //	bool: True if the path exists on disk else false.
-//	error: The fs.ErrNotExist error if the path does not exist else nil.
+//	error: Any error from os.Stat other than fs.ErrNotExist, such as a permission
+//	error, else nil. A missing path returns false with a nil error.
 func pathExists(path string) (bool, error) {
-	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
-		return false, err
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
 	}
-	return true, nil
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+// Helper function that determines if a path exists without following a symlink at the
+// end of it, so a dangling symlink counts as existing.
+// Args:
+//
+//	path(string): The path to check.
+//
+// Returns:
+//
+//	bool: True if the path exists on disk, or is a symlink, else false.
+//	error: Any error from os.Lstat other than fs.ErrNotExist, else nil.
+func entryExists(path string) (bool, error) {
+	_, err := os.Lstat(path)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
 }
 
 // A helper function to determine if a path is a directory not not.
@@ -56,258 +147,4822 @@ func isDir(path string) (bool, error) {
 	return fileInfo.IsDir(), nil
 }
 
-// Gets the content names, or full path for contents, of a directory.
+// Determines if a path exists on disk and is a regular file.
 // Args:
 //
-//	path(string): Directory path to list the contents of.
-//	fullPath(bool): To return string names or full paths of directory contents.
+//	path(string): The path to check.
 //
 // Returns:
 //
-//	[]string: String names or full paths of directory contents.
-//	error: Any error created from attempting to read the directory, else nil.
-func GetDirContents(path string, fullPath bool) ([]string, error) {
-	var contents []string
-
-	items, err := os.ReadDir(path)
+//	bool: True if the path exists and is a regular file, false for directories or missing paths.
+//	error: Any error from os.Stat other than fs.ErrNotExist, else nil.
+func FileExists(path string) (bool, error) {
+	info, err := os.Stat(path)
 	if err != nil {
-		return make([]string, 0), err
-	}
-	for _, item := range items {
-		var entry string
-		if fullPath {
-			entry = fmt.Sprintf("%s%s", path, item.Name())
-		} else {
-			entry = item.Name()
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
 		}
-		contents = append(contents, entry)
+		return false, err
 	}
-	return contents, nil
+	return info.Mode().IsRegular(), nil
 }
 
-// Creates a directory from teh given path.
+// Determines if a path exists on disk and is a directory.
 // Args:
 //
-//	path(string): The directory path to create.
+//	path(string): The path to check.
 //
 // Returns:
 //
-//	error: Any error created while attempting to create the directory, else nil.
-func CreateDirectory(path string) error {
-	exists, _ := pathExists(path)
-	if !exists {
-		err := os.Mkdir(path, 0777)
-		if err != nil {
-			return err
-		}
+//	bool: True if the path exists and is a directory, false for files or missing paths.
+//	error: Any error from os.Stat other than fs.ErrNotExist, else nil.
+func DirExists(path string) (bool, error) {
+	exists, err := pathExists(path)
+	if err != nil || !exists {
+		return false, err
 	}
-	return nil
+	return isDir(path)
 }
 
-// Creates a directory with today's date as the name.
+// Sets the safety path that the "Safe" delete functions are restricted to.
+// The default remains "D:/safety/" until this is called.
 // Args:
 //
-//	path(styring): The path to create the new folder in.
+//	path(string): The directory to use as the safety path, resolved to an absolute path.
 //
 // Returns:
 //
-//	error: Any error created while attempting to create the directory, else nil.
-func CreateDatedDirectory(path string) error {
-	datePath := filepath.Join(path, GetDate())
-	err := CreateDirectory(datePath)
+//	error: An error if the path is empty or could not be made absolute, else nil.
+func SetSafetyPath(path string) error {
+	if strings.TrimSpace(path) == "" {
+		return errors.New("safety path cannot be empty")
+	}
+	absPath, err := filepath.Abs(NormalizePath(path))
 	if err != nil {
 		return err
 	}
+	if !strings.HasSuffix(absPath, string(os.PathSeparator)) {
+		absPath += string(os.PathSeparator)
+	}
+	safetyPath = absPath
 	return nil
 }
 
-// Deletes a directory and its contents as long as they are within the safety path.
+// Returns string: the current safety path used by the "Safe" functions.
+func GetSafetyPath() string {
+	return safetyPath
+}
+
+// Helper function for determining if a path is contained by the safety path. The
+// returned path has the symlinks of its parent directories resolved, so callers act on
+// exactly the file or directory that was checked. A final component that is itself a
+// symlink is kept as is, but is only accepted if its target is also within the safety path.
 // Args:
 //
-//	folderPath(string): The folder path to delete.
+//	path(string): The path to check.
 //
 // Returns:
 //
-//	error: the *PathError created from os.RemoveAll if one was created, else nil.
-func DeleteSafeDirectory(folderPath string) error {
-	if strings.HasPrefix(folderPath, safetyPath) {
-		err := os.RemoveAll(folderPath)
-		if err != nil {
-			return err
-		}
-		return nil
+//	string: The resolved path to act on, empty if the path is not within the safety path.
+//	bool: True if the path is the safety path or is beneath it else false.
+//	error: Any error created while resolving either path to an absolute path, else nil.
+func withinSafetyPath(path string) (string, bool, error) {
+	baseAbs, err := ResolveAbs(safetyPath)
+	if err != nil {
+		return "", false, err
+	}
+	target, err := resolveParent(path)
+	if err != nil {
+		return "", false, err
+	}
+	targetAbs, err := ResolveAbs(target)
+	if err != nil {
+		return "", false, err
+	}
+
+	if !containsPath(baseAbs, target) || !containsPath(baseAbs, targetAbs) {
+		return "", false, nil
 	}
-	errorMsg := fmt.Sprintf("folder path is not within %s", safetyPath)
-	return errors.New(errorMsg)
+	return target, true, nil
 }
 
-// Removes specified file as long as it is within the safety path.
+// Helper function for determining if a path is contained by a base directory.
+// Both paths are resolved with ResolveAbs before comparing so that "../" traversal
+// or symlinks pointing elsewhere cannot escape the base.
 // Args:
 //
-//	filepath(string): The path to the file you wish to delete.
+//	base(string): The directory that should contain the path.
+//	path(string): The path to check.
 //
 // Returns:
 //
-//	error: A custom error if the filepath was not within the safety path or a *PathError err from
-//	os.Remove, else Nil.
-func DeleteSafeFile(filepath string) error {
-	if strings.HasPrefix(filepath, safetyPath) {
-		err := os.Remove(filepath)
-		if err != nil {
-			return err
-		}
-		return nil
+//	bool: True if the path is the base or is beneath it else false.
+//	error: Any error created while resolving either path, else nil.
+func isWithin(base string, path string) (bool, error) {
+	baseAbs, err := ResolveAbs(base)
+	if err != nil {
+		return false, err
+	}
+	targetAbs, err := ResolveAbs(path)
+	if err != nil {
+		return false, err
 	}
-	errorMsg := fmt.Sprintf("file path is not within %s", safetyPath)
-	return errors.New(errorMsg)
+	return containsPath(baseAbs, targetAbs), nil
 }
 
-// Delete all files in a directory as long as they are within the safety path.
+// Helper function for determining if an absolute path is a base directory or beneath it.
 // Args:
 //
-//	directory_path(string): The path to the directory.
+//	baseAbs(string): The absolute directory that should contain the path.
+//	targetAbs(string): The absolute path to check.
 //
 // Returns:
 //
-//	any *PathError crated from DeleteSafeFile or errors from GetDirContents, else nil.
-func DeleteSafeFilesInDirectory(folderPath string) error {
-	if strings.HasPrefix(folderPath, safetyPath) {
-		files, err := GetDirContents(folderPath, true)
-		if err != nil {
-			return err
-		}
-		for _, file := range files {
-			err := DeleteSafeFile(file)
+//	bool: True if the target is the base or is beneath it else false.
+func containsPath(baseAbs string, targetAbs string) bool {
+	rel, err := filepath.Rel(baseAbs, targetAbs)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// Resolves a path to a clean absolute path with any symlinks evaluated. Symlinks are
+// resolved one component at a time before any following "..", the same way the OS
+// walks the path, so "link/.." is the parent of the link's target rather than the
+// directory holding the link. Components that do not exist yet are kept as they are.
+// Args:
+//
+//	path(string): The path to resolve.
+//
+// Returns:
+//
+//	string: The absolute path with symlinks resolved.
+//	error: ErrSymlinkCycle if resolving the path follows too many symlinks, any error
+//	from reading the path other than fs.ErrNotExist, else nil.
+func ResolveAbs(path string) (string, error) {
+	if os.PathSeparator == '\\' {
+		// Windows collapses ".." in a path before walking it, rather than after symlinks.
+		path = filepath.Clean(path)
+	}
+	if !filepath.IsAbs(path) {
+		if filepath.VolumeName(path) != "" || (path != "" && os.IsPathSeparator(path[0])) {
+			absPath, err := filepath.Abs(path)
 			if err != nil {
-				return err
+				return "", err
 			}
+			path = absPath
+		} else {
+			wd, err := os.Getwd()
+			if err != nil {
+				return "", err
+			}
+			path = wd + string(os.PathSeparator) + path
 		}
-		return nil
 	}
-	errorMsg := fmt.Sprintf("file path is not within %s", safetyPath)
-	return errors.New(errorMsg)
+
+	volume := filepath.VolumeName(path)
+	resolved := volume + string(os.PathSeparator)
+	pending := splitPath(path[len(volume):])
+	links := 0
+	for len(pending) > 0 {
+		part := pending[0]
+		pending = pending[1:]
+		if part == "." {
+			continue
+		}
+		if part == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+		info, err := os.Lstat(next)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("%w: %s", ErrSymlinkCycle, path)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			volume = filepath.VolumeName(target)
+			resolved = volume + string(os.PathSeparator)
+			target = target[len(volume):]
+		}
+		pending = append(splitPath(target), pending...)
+	}
+	return resolved, nil
 }
 
-// Copy file into a separate destination folder.
+// The most symlinks ResolveAbs follows before reporting a cycle.
+const maxSymlinks = 255
+
+// Helper function that splits a path into its non-empty components without cleaning it.
 // Args:
 //
-//	source(string): File path of the file to copy.
-//	dest(string): File path to copy the file too, optionally can have different name.
+//	path(string): The path to split, without a volume name.
 //
 // Returns:
 //
-//	error: *PathError crated from os module or possible other error from io module else nil.
-func CopyFile(source string, dest string) error {
-	sourceFile, err := os.Open(source)
-	if err != nil {
-		return err
+//	[]string: The components of the path, including any "." and ".." components.
+func splitPath(path string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i <= len(path); i++ {
+		if i < len(path) && !os.IsPathSeparator(path[i]) {
+			continue
+		}
+		if i > start {
+			parts = append(parts, path[start:i])
+		}
+		start = i + 1
 	}
-	defer sourceFile.Close()
+	return parts
+}
 
-	destFile, err := os.Create(dest)
-	if err != nil {
-		return err
+// Helper function that resolves the symlinks in a path's parent directories while keeping
+// its final component as is, so a symlink is acted on rather than its target.
+// Args:
+//
+//	path(string): The path to resolve.
+//
+// Returns:
+//
+//	string: The absolute path with its parent directories resolved.
+//	error: Any error from ResolveAbs, else nil.
+func resolveParent(path string) (string, error) {
+	volume := filepath.VolumeName(path)
+	parts := splitPath(path[len(volume):])
+	if len(parts) == 0 {
+		return ResolveAbs(path)
+	}
+	name := parts[len(parts)-1]
+	if name == "." || name == ".." {
+		return ResolveAbs(path)
 	}
-	defer destFile.Close()
 
-	_, err = io.Copy(destFile, sourceFile)
+	end := strings.LastIndex(path, name)
+	dir := path[:end]
+	if dir == "" {
+		dir = "."
+	}
+	dirAbs, err := ResolveAbs(dir)
 	if err != nil {
-		return err
+		return "", err
 	}
+	return filepath.Join(dirAbs, name), nil
+}
 
-	return nil
+// Cleans a path and converts its separators to the OS-native separator, so that mixed
+// separator inputs such as "D:/safety\files" are consistent on Windows. On other systems
+// "\" is a legal filename character rather than a separator, so it is left as is.
+// Args:
+//
+//	path(string): The path to normalize.
+//
+// Returns:
+//
+//	string: The cleaned path using only OS-native separators.
+func NormalizePath(path string) string {
+	// On Windows filepath.Clean also replaces every "/" with "\".
+	return filepath.Clean(path)
 }
 
-// Copy contents of a folder to the given destination.
+// Cleans a path and converts its OS-native separators to forward slashes.
 // Args:
 //
-//	sourcePath(string): Folder path to the folder that is to be copied.
-//	destination(string): Folder path to copy the folder + contents to.
+//	path(string): The path to convert.
 //
 // Returns:
 //
-//	error: Any relevant errors created durring process, usually os *PathErrors else nil.
-func CopyFolderContents(sourcePath string, destination string) error {
-	sourcePath = filepath.Clean(sourcePath)
-	destination = filepath.Clean(destination)
+//	string: The cleaned path using only "/" separators.
+func ToSlashPath(path string) string {
+	return strings.ReplaceAll(NormalizePath(path), string(os.PathSeparator), "/")
+}
 
-	err := CreateDirectory(destination)
+// Gets the content names, or full path for contents, of a directory.
+// Args:
+//
+//	path(string): Directory path to list the contents of.
+//	fullPath(bool): To return string names or full paths of directory contents.
+//
+// Returns:
+//
+//	[]string: String names or full paths of directory contents, nil on error.
+//	error: Any error created from attempting to read the directory, else nil.
+func GetDirContents(path string, fullPath bool) ([]string, error) {
+	var contents []string
+
+	items, err := os.ReadDir(path)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	for _, item := range items {
+		var entry string
+		if fullPath {
+			entry = filepath.Clean(filepath.Join(path, item.Name()))
+		} else {
+			entry = item.Name()
+		}
+		contents = append(contents, entry)
 	}
+	return contents, nil
+}
 
-	curItems, err := GetDirContents(sourcePath, false)
+// How many directory entries IterDir reads from disk at a time.
+const iterDirBatchSize = 256
+
+// Reads the next batch of entries for IterDir, replaceable so tests can simulate a
+// read that fails part way through a batch.
+var readDirBatch = (*os.File).ReadDir
+
+// Opens a directory for iterating its content names one at a time, reading entries
+// from disk in small batches so memory stays flat for very large directories.
+// The directory is closed once the iterator is exhausted or returns an error, so
+// callers that stop early leave it open until the iterator is garbage collected.
+// Args:
+//
+//	path(string): Directory path to iterate the contents of.
+//
+// Returns:
+//
+//	func() (string, bool, error): Returns the next content name and true, or an empty
+//	string and false once every entry has been returned or an error occurs.
+//	error: Any error created from attempting to open the directory, else nil.
+func IterDir(path string) (func() (string, bool, error), error) {
+	dir, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, item := range curItems {
-		curItemPath := filepath.Clean(filepath.Join(sourcePath, item))
-		destPath := filepath.Clean(filepath.Join(destination, item))
-
-		dir, err := isDir(curItemPath)
-		if err != nil {
-			return err
+	var batch []fs.DirEntry
+	var readErr error
+	done := false
+	next := func() (string, bool, error) {
+		if done {
+			return "", false, nil
 		}
-		if dir {
-			err := CopyFolderContents(curItemPath, destPath)
-			if err != nil {
-				return err
+
+		if len(batch) == 0 {
+			// A batch can arrive with an error, which is kept until the batch is drained.
+			if readErr == nil {
+				batch, readErr = readDirBatch(dir, iterDirBatchSize)
 			}
-		} else {
-			err := CopyFile(curItemPath, destPath)
-			if err != nil {
-				return err
+			if len(batch) == 0 {
+				done = true
+				dir.Close()
+				if readErr == io.EOF {
+					return "", false, nil
+				}
+				return "", false, readErr
 			}
 		}
+
+		name := batch[0].Name()
+		batch = batch[1:]
+		return name, true, nil
 	}
-	return nil
+	return next, nil
 }
 
-// Returns string: 'yyyymmdd'.
-func GetDate() string {
-	return time.Now().Format("20060102")
-}
+// The order that GetDirContentsFiltered returns entries in.
+type SortOrder int
 
-// Returns string: 'HH:MM:SS:XX', X is microsecond.
-func GetTime() string {
-	return time.Now().Format("15:04:05:00")
+const (
+	SortNone SortOrder = iota
+	SortNameAsc
+	SortNameDesc
+	SortModTimeAsc
+	SortModTimeDesc
+)
+
+// Options controlling which entries GetDirContentsFiltered returns and in what order.
+type ListOptions struct {
+	// Glob pattern, matched with filepath.Match against entry names. Empty matches everything.
+	Pattern string
+	// Only return files, excluding directories.
+	FilesOnly bool
+	// Only return directories, excluding files.
+	DirsOnly bool
+	// The order to return entries in.
+	Sort SortOrder
 }
 
-// Exports a string map to json file path.
+// Gets the filtered and sorted content names, or full paths, of a directory.
 // Args:
 //
-//	fielpath(string): The file path to place the .json file.
-//	data(map[string]interface{}): Any map with string keys and values that can be converted to strings.
-//	overWrite(bool): To overwrite json file if it already exists in path.
+//	path(string): Directory path to list the contents of.
+//	fullPath(bool): To return string names or full paths of directory contents.
+//	opts(ListOptions): The pattern, entry type, and sort order to apply.
 //
 // Returns:
 //
-//	error: Any relevant error from the json handling or file writing process.
-func ExportMapToJson(filePath string, data map[string]interface{}, overWrite bool) error {
-	exists, err := pathExists(filePath)
+//	[]string: String names or full paths of matching directory contents.
+//	error: Any error created from reading the directory or a malformed pattern, else nil.
+func GetDirContentsFiltered(path string, fullPath bool, opts ListOptions) ([]string, error) {
+	items, err := os.ReadDir(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if !exists || overWrite {
-		jsonData, err := json.Marshal(data)
-		if err != nil {
-			return err
+	var matches []fs.FileInfo
+	for _, item := range items {
+		if opts.FilesOnly && item.IsDir() {
+			continue
 		}
-
-		file, err := os.Create(filePath)
-		if err != nil {
-			return err
+		if opts.DirsOnly && !item.IsDir() {
+			continue
+		}
+		if opts.Pattern != "" {
+			matched, err := filepath.Match(opts.Pattern, item.Name())
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
 		}
-		defer file.Close()
 
-		_, err = file.Write(jsonData)
+		info, err := item.Info()
 		if err != nil {
-			return err
+			return nil, err
 		}
+		matches = append(matches, info)
+	}
 
-		return nil
+	switch opts.Sort {
+	case SortNameAsc:
+		sort.Slice(matches, func(i, j int) bool { return matches[i].Name() < matches[j].Name() })
+	case SortNameDesc:
+		sort.Slice(matches, func(i, j int) bool { return matches[i].Name() > matches[j].Name() })
+	case SortModTimeAsc:
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].ModTime().Before(matches[j].ModTime()) })
+	case SortModTimeDesc:
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].ModTime().After(matches[j].ModTime()) })
 	}
-	return nil
+
+	var contents []string
+	for _, info := range matches {
+		entry := info.Name()
+		if fullPath {
+			entry = filepath.Clean(filepath.Join(path, info.Name()))
+		}
+		contents = append(contents, entry)
+	}
+	return contents, nil
+}
+
+// Gets the names, or full paths, of the files in a directory with any of the given extensions.
+// Args:
+//
+//	path(string): Directory path to list the contents of.
+//	fullPath(bool): To return string names or full paths of directory contents.
+//	exts(...string): Extensions to match case-insensitively, with or without the leading
+//	dot. When none are given every entry is returned like GetDirContents.
+//
+// Returns:
+//
+//	[]string: String names or full paths of the matching files.
+//	error: Any error created from attempting to read the directory, else nil.
+func GetDirContentsByExt(path string, fullPath bool, exts ...string) ([]string, error) {
+	if len(exts) == 0 {
+		return GetDirContents(path, fullPath)
+	}
+
+	wanted := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		wanted["."+strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+	}
+
+	items, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var contents []string
+	for _, item := range items {
+		if item.IsDir() || !wanted[strings.ToLower(filepath.Ext(item.Name()))] {
+			continue
+		}
+		entry := item.Name()
+		if fullPath {
+			entry = filepath.Clean(filepath.Join(path, item.Name()))
+		}
+		contents = append(contents, entry)
+	}
+	return contents, nil
+}
+
+// Gets the content names, or full paths, of a directory excluding hidden entries.
+// Entries are hidden when their name starts with "." or, on Windows, when they
+// have the hidden attribute.
+// Args:
+//
+//	path(string): Directory path to list the contents of.
+//	fullPath(bool): To return string names or full paths of directory contents.
+//
+// Returns:
+//
+//	[]string: String names or full paths of the visible directory contents.
+//	error: Any error created from attempting to read the directory, else nil.
+func GetDirContentsVisible(path string, fullPath bool) ([]string, error) {
+	items, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var contents []string
+	for _, item := range items {
+		if strings.HasPrefix(item.Name(), ".") {
+			continue
+		}
+		info, err := item.Info()
+		if err != nil {
+			return nil, err
+		}
+		if hasHiddenAttribute(info) {
+			continue
+		}
+
+		entry := item.Name()
+		if fullPath {
+			entry = filepath.Clean(filepath.Join(path, item.Name()))
+		}
+		contents = append(contents, entry)
+	}
+	return contents, nil
+}
+
+// Gets the names, or full paths, of only the subdirectories of a directory.
+// Args:
+//
+//	path(string): Directory path to list the subdirectories of.
+//	fullPath(bool): To return string names or full paths of the subdirectories.
+//
+// Returns:
+//
+//	[]string: String names or full paths of the subdirectories.
+//	error: Any error created from attempting to read the directory, else nil.
+func GetSubdirectories(path string, fullPath bool) ([]string, error) {
+	return GetDirContentsFiltered(path, fullPath, ListOptions{DirsOnly: true})
+}
+
+// Recursively gets the content names, or full paths, of everything beneath a directory.
+// Symlinks are listed but never followed, so symlink loops cannot cause the walk to hang.
+// Args:
+//
+//	root(string): Directory path to walk the contents of.
+//	fullPath(bool): To return paths relative to root or full paths of the contents.
+//	includeDirs(bool): To include subdirectories in the results or only files.
+//
+// Returns:
+//
+//	[]string: Relative or full paths of every item beneath root.
+//	error: Any error created from walking the directory tree, else nil.
+func WalkDirContents(root string, fullPath bool, includeDirs bool) ([]string, error) {
+	var contents []string
+
+	root = filepath.Clean(root)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if d.IsDir() && !includeDirs {
+			return nil
+		}
+
+		entry := path
+		if !fullPath {
+			entry, err = filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+		}
+		contents = append(contents, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking %s: %w", root, err)
+	}
+	return contents, nil
+}
+
+// Recursively walks a directory tree, calling fn for every file and directory,
+// including root, without collecting the paths into a slice.
+// Args:
+//
+//	root(string): Directory path to walk.
+//	fn(func(path string, info os.FileInfo, err error) error): Called for each path,
+//	return SkipDir to skip a directory or any other error to stop the walk.
+//
+// Returns:
+//
+//	error: Any error returned by fn or created from walking the directory tree, else nil.
+func Walk(root string, fn func(path string, info os.FileInfo, err error) error) error {
+	root = filepath.Clean(root)
+	err := filepath.Walk(root, fn)
+	if err != nil {
+		return fmt.Errorf("walking %s: %w", root, err)
+	}
+	return nil
+}
+
+// Recursively gets the paths of every file beneath a directory relative to it.
+// Paths always use "/" separators so they are stable across platforms.
+// Args:
+//
+//	root(string): Directory path to walk the contents of.
+//
+// Returns:
+//
+//	[]string: Forward slash paths of every file relative to root.
+//	error: Any error created from walking the directory tree, else nil.
+func GetDirContentsRelative(root string) ([]string, error) {
+	files, err := WalkDirContents(root, false, false)
+	if err != nil {
+		return nil, err
+	}
+	for i, file := range files {
+		files[i] = filepath.ToSlash(file)
+	}
+	return files, nil
+}
+
+// Gets the content names, or full paths, of a directory down to a maximum depth.
+// Args:
+//
+//	path(string): Directory path to list the contents of.
+//	fullPath(bool): To return paths relative to path or full paths of the contents.
+//	maxDepth(int): How many levels below path to list, 0 lists only the directory
+//	itself like GetDirContents and -1 lists everything.
+//
+// Returns:
+//
+//	[]string: Relative or full paths of files and directories within the depth.
+//	error: Any error created from walking the directory tree, else nil.
+func GetDirContentsDepth(path string, fullPath bool, maxDepth int) ([]string, error) {
+	var contents []string
+
+	root := filepath.Clean(path)
+	err := filepath.WalkDir(root, func(itemPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if itemPath == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, itemPath)
+		if err != nil {
+			return err
+		}
+		depth := strings.Count(rel, string(os.PathSeparator))
+
+		if fullPath {
+			contents = append(contents, itemPath)
+		} else {
+			contents = append(contents, rel)
+		}
+		if d.IsDir() && maxDepth >= 0 && depth >= maxDepth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// Gets the total size of all regular files beneath a directory.
+// Symlinks are not followed or counted, so linked files are never counted twice.
+// Args:
+//
+//	path(string): Directory path to compute the size of.
+//
+// Returns:
+//
+//	int64: The total size in bytes.
+//	error: A wrapped error from walking the directory tree, else nil.
+func GetDirSize(path string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(path, func(itemPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("getting size of %s: %w", path, err)
+	}
+	return size, nil
+}
+
+// Creates a directory from the given path. The parent directory must already
+// exist, use CreateDirectoryAll to create any missing parents as well.
+// Args:
+//
+//	path(string): The directory path to create.
+//
+// Returns:
+//
+//	error: Any error created while attempting to create the directory, else nil.
+func CreateDirectory(path string) error {
+	return CreateDirectoryMode(path, 0777)
+}
+
+// Creates a directory from the given path with the given permissions. As with
+// os.Mkdir the permissions are reduced by the process umask. An existing directory
+// is left unchanged.
+// Args:
+//
+//	path(string): The directory path to create.
+//	mode(os.FileMode): The permission bits to create the directory with, before umask.
+//
+// Returns:
+//
+//	error: Any error created while attempting to create the directory, else nil.
+func CreateDirectoryMode(path string, mode os.FileMode) error {
+	exists, err := pathExists(path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		err := os.Mkdir(path, mode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates a directory from the given path along with any missing parent directories.
+// Args:
+//
+//	path(string): The directory path to create.
+//
+// Returns:
+//
+//	error: Any error created while attempting to create the directories, else nil.
+func CreateDirectoryAll(path string) error {
+	err := os.MkdirAll(path, 0777)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Creates a directory with today's date as the name.
+// Args:
+//
+//	path(styring): The path to create the new folder in.
+//
+// Returns:
+//
+//	error: Any error created while attempting to create the directory, else nil.
+func CreateDatedDirectory(path string) error {
+	_, err := CreateDatedDirectoryPath(path)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Creates a directory with today's date as the name and returns its path.
+// Args:
+//
+//	path(string): The path to create the new folder in.
+//
+// Returns:
+//
+//	string: The full path of the created, or pre-existing, dated directory.
+//	error: Any error created while attempting to create the directory, else nil.
+func CreateDatedDirectoryPath(path string) (string, error) {
+	datePath := filepath.Join(path, GetDate())
+	err := CreateDirectory(datePath)
+	if err != nil {
+		return "", err
+	}
+	return datePath, nil
+}
+
+// Creates a directory named from today's date using a custom time layout, creating
+// any intermediate folders the layout produces, such as "2006/01/02".
+// Args:
+//
+//	path(string): The path to create the new folder in.
+//	layout(string): A Go time layout used to format today's date.
+//
+// Returns:
+//
+//	string: The full path of the created, or pre-existing, dated directory.
+//	error: A custom error if the formatted date contains illegal path characters,
+//	ErrPathEscapes if it escapes path, any error created while creating the directories, else nil.
+func CreateDatedDirectoryFormat(path string, layout string) (string, error) {
+	dateName := clock().Format(layout)
+	if dateName == "" || strings.ContainsAny(dateName, `<>:"|?*`) {
+		errorMsg := fmt.Sprintf("date layout %s produces an illegal path %s", layout, dateName)
+		return "", errors.New(errorMsg)
+	}
+	for _, char := range dateName {
+		if char < 32 {
+			errorMsg := fmt.Sprintf("date layout %s produces an illegal path %s", layout, dateName)
+			return "", errors.New(errorMsg)
+		}
+	}
+
+	datePath := filepath.Join(path, dateName)
+	inPath, err := isWithin(path, datePath)
+	if err != nil {
+		return "", err
+	}
+	if !inPath {
+		return "", fmt.Errorf("%w: date layout %s escapes %s", ErrPathEscapes, layout, path)
+	}
+
+	err = CreateDirectoryAll(datePath)
+	if err != nil {
+		return "", err
+	}
+	return datePath, nil
+}
+
+// Deletes a directory and its contents as long as they are within the safety path.
+// Args:
+//
+//	folderPath(string): The folder path to delete.
+//
+// Returns:
+//
+//	error: ErrOutsideSafetyPath if the folder path was not within the safety path, the
+//	*PathError created from os.RemoveAll if one was created, else nil.
+func DeleteSafeDirectory(folderPath string) (err error) {
+	defer func() { logOperation("DeleteSafeDirectory", folderPath, err) }()
+
+	target, inSafetyPath, err := withinSafetyPath(folderPath)
+	if err != nil {
+		return err
+	}
+	if inSafetyPath {
+		err := WithRetry(deleteRetryAttempts, deleteRetryDelay, func() error {
+			return removeAll(target)
+		})
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: folder path %s is not within %s", ErrOutsideSafetyPath, folderPath, safetyPath)
+}
+
+// Deletes as much of a directory and its contents as possible as long as it is within
+// the safety path. Unlike DeleteSafeDirectory, a failure to remove one item does not stop
+// the delete, every item that can be removed is removed and the failures are returned.
+// Args:
+//
+//	folderPath(string): The folder path to delete.
+//
+// Returns:
+//
+//	[]error: The error of each item that could not be read or removed, nil if everything
+//	was deleted.
+//	error: ErrOutsideSafetyPath if the folder path was not within the safety path, any
+//	error from checking the safety path, else nil.
+func DeleteSafeDirectoryBestEffort(folderPath string) (failures []error, err error) {
+	defer func() { logOperation("DeleteSafeDirectoryBestEffort", folderPath, err) }()
+
+	target, inSafetyPath, err := withinSafetyPath(folderPath)
+	if err != nil {
+		return nil, err
+	}
+	if !inSafetyPath {
+		return nil, fmt.Errorf("%w: folder path %s is not within %s", ErrOutsideSafetyPath, folderPath, safetyPath)
+	}
+
+	exists, err := pathExists(target)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	// Directories with an entry that could not be read or removed are left in place,
+	// since removing them would only add a "directory not empty" failure.
+	blocked := make(map[string]bool)
+	var paths []string
+	filepath.WalkDir(target, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			failures = append(failures, err)
+			blocked[path] = true
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+
+	for i := len(paths) - 1; i >= 0; i-- {
+		path := paths[i]
+		if blocked[path] {
+			blocked[filepath.Dir(path)] = true
+			continue
+		}
+
+		err := removeFile(path)
+		if err != nil {
+			failures = append(failures, err)
+			blocked[filepath.Dir(path)] = true
+		}
+	}
+	return failures, nil
+}
+
+// Lists everything DeleteSafeDirectory would remove without deleting anything.
+// Args:
+//
+//	folderPath(string): The folder path to check.
+//
+// Returns:
+//
+//	[]string: Full paths of the folder and every file and directory beneath it.
+//	error: ErrOutsideSafetyPath if the folder path was not within the safety path or any
+//	error from walking the tree, else nil.
+func DeleteSafeDirectoryDryRun(folderPath string) ([]string, error) {
+	target, inSafetyPath, err := withinSafetyPath(folderPath)
+	if err != nil {
+		return nil, err
+	}
+	if inSafetyPath {
+		exists, err := pathExists(target)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, nil
+		}
+
+		var paths []string
+		err = filepath.WalkDir(target, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			paths = append(paths, path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return paths, nil
+	}
+	return nil, fmt.Errorf("%w: folder path %s is not within %s", ErrOutsideSafetyPath, folderPath, safetyPath)
+}
+
+// Removes every file and subdirectory in a directory, keeping the directory itself
+// and its permissions, as long as it is within the safety path.
+// Args:
+//
+//	folderPath(string): The folder path to empty.
+//
+// Returns:
+//
+//	error: ErrOutsideSafetyPath if the folder path was not within the safety path, any
+//	error from reading the directory or removing its contents, else nil.
+func EmptySafeDirectory(folderPath string) (err error) {
+	defer func() { logOperation("EmptySafeDirectory", folderPath, err) }()
+
+	target, inSafetyPath, err := withinSafetyPath(folderPath)
+	if err != nil {
+		return err
+	}
+	if inSafetyPath {
+		items, err := GetDirContents(target, true)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			err := os.RemoveAll(item)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: folder path %s is not within %s", ErrOutsideSafetyPath, folderPath, safetyPath)
+}
+
+// Removes specified file as long as it is within the safety path.
+// Args:
+//
+//	filepath(string): The path to the file you wish to delete.
+//
+// Returns:
+//
+//	error: ErrOutsideSafetyPath if the filepath was not within the safety path or a *PathError err from
+//	os.Remove, else Nil.
+func DeleteSafeFile(filepath string) (err error) {
+	defer func() { logOperation("DeleteSafeFile", filepath, err) }()
+
+	target, inSafetyPath, err := withinSafetyPath(filepath)
+	if err != nil {
+		return err
+	}
+	if inSafetyPath {
+		err := WithRetry(deleteRetryAttempts, deleteRetryDelay, func() error {
+			return removeFile(target)
+		})
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: file path %s is not within %s", ErrOutsideSafetyPath, filepath, safetyPath)
+}
+
+// Delete all files directly in a directory as long as they are within the safety path.
+// Subdirectories and their contents are skipped and left intact, use
+// DeleteSafeFilesInDirectoryRecursive to also clear files in subdirectories.
+// Args:
+//
+//	folderPath(string): The path to the directory.
+//
+// Returns:
+//
+//	ErrOutsideSafetyPath if the folder path was not within the safety path, any
+//	*PathError crated from DeleteSafeFile or errors from GetDirContents, else nil.
+func DeleteSafeFilesInDirectory(folderPath string) (err error) {
+	defer func() { logOperation("DeleteSafeFilesInDirectory", folderPath, err) }()
+
+	target, inSafetyPath, err := withinSafetyPath(folderPath)
+	if err != nil {
+		return err
+	}
+	if inSafetyPath {
+		files, err := GetDirContentsFiltered(target, true, ListOptions{FilesOnly: true})
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			err := DeleteSafeFile(file)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: folder path %s is not within %s", ErrOutsideSafetyPath, folderPath, safetyPath)
+}
+
+// Delete all files in a directory and its subdirectories as long as they are within
+// the safety path. The directory structure itself is left intact.
+// Args:
+//
+//	folderPath(string): The path to the directory.
+//
+// Returns:
+//
+//	ErrOutsideSafetyPath if the folder path was not within the safety path, any
+//	*PathError crated from DeleteSafeFile or errors from WalkDirContents, else nil.
+func DeleteSafeFilesInDirectoryRecursive(folderPath string) (err error) {
+	defer func() { logOperation("DeleteSafeFilesInDirectoryRecursive", folderPath, err) }()
+
+	target, inSafetyPath, err := withinSafetyPath(folderPath)
+	if err != nil {
+		return err
+	}
+	if inSafetyPath {
+		files, err := WalkDirContents(target, true, false)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			err := DeleteSafeFile(file)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: folder path %s is not within %s", ErrOutsideSafetyPath, folderPath, safetyPath)
+}
+
+// Renames a file as long as both the old and new paths are within the safety path.
+// Args:
+//
+//	oldPath(string): The current path of the file.
+//	newPath(string): The path to rename the file to.
+//
+// Returns:
+//
+//	error: ErrOutsideSafetyPath if either path was not within the safety path or a *LinkError
+//	from os.Rename, else nil.
+func RenameSafeFile(oldPath string, newPath string) (err error) {
+	defer func() { logOperation("RenameSafeFile", oldPath, err) }()
+
+	targets := make([]string, 2)
+	for i, path := range []string{oldPath, newPath} {
+		target, inSafetyPath, err := withinSafetyPath(path)
+		if err != nil {
+			return err
+		}
+		if !inSafetyPath {
+			return fmt.Errorf("%w: file path %s is not within %s", ErrOutsideSafetyPath, path, safetyPath)
+		}
+		targets[i] = target
+	}
+
+	err = os.Rename(targets[0], targets[1])
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Renames every file beneath a directory whose name contains a substring, replacing each
+// occurrence of it, as long as the directory is within the safety path. Every new path is
+// checked before anything is renamed, so a collision leaves the tree untouched.
+// Args:
+//
+//	root(string): The directory to walk for files to rename.
+//	find(string): The substring to look for in each file's base name.
+//	replace(string): The string to replace each occurrence of find with.
+//
+// Returns:
+//
+//	[]string: The new full paths of the renamed files, nil on error.
+//	error: ErrOutsideSafetyPath if root or a new path was not within the safety path,
+//	ErrDestExists if a new path already exists or two files would be renamed to the same
+//	path, a custom error if find is empty or replace contains a path separator or "..",
+//	any error from walking the directory or renaming, else nil.
+func RenameFilesByPattern(root string, find string, replace string) (renamed []string, err error) {
+	defer func() { logOperation("RenameFilesByPattern", root, err) }()
+
+	if find == "" {
+		return nil, errors.New("find string cannot be empty")
+	}
+	if strings.ContainsAny(replace, `/`+string(os.PathSeparator)) || strings.Contains(replace, "..") {
+		errorMsg := fmt.Sprintf("replace string %s cannot contain a path separator or ..", replace)
+		return nil, errors.New(errorMsg)
+	}
+
+	target, inSafetyPath, err := withinSafetyPath(root)
+	if err != nil {
+		return nil, err
+	}
+	if !inSafetyPath {
+		return nil, fmt.Errorf("%w: folder path %s is not within %s", ErrOutsideSafetyPath, root, safetyPath)
+	}
+
+	files, err := WalkDirContents(target, true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var oldPaths []string
+	var newPaths []string
+	targets := make(map[string]string)
+	for _, file := range files {
+		name := filepath.Base(file)
+		if !strings.Contains(name, find) {
+			continue
+		}
+
+		newName := strings.ReplaceAll(name, find, replace)
+		if newName == "" || newName == "." || newName == ".." {
+			errorMsg := fmt.Sprintf("renaming %s would not leave a valid file name", file)
+			return nil, errors.New(errorMsg)
+		}
+		newPath := filepath.Join(filepath.Dir(file), newName)
+		_, inSafetyPath, err := withinSafetyPath(newPath)
+		if err != nil {
+			return nil, err
+		}
+		if !inSafetyPath {
+			return nil, fmt.Errorf("%w: file path %s is not within %s", ErrOutsideSafetyPath, newPath, safetyPath)
+		}
+
+		other, found := targets[newPath]
+		if found {
+			return nil, fmt.Errorf("%w: %s and %s both rename to %s", ErrDestExists, other, file, newPath)
+		}
+		exists, err := pathExists(newPath)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, fmt.Errorf("%w: %s", ErrDestExists, newPath)
+		}
+
+		targets[newPath] = file
+		oldPaths = append(oldPaths, file)
+		newPaths = append(newPaths, newPath)
+	}
+
+	for i := range oldPaths {
+		err := os.Rename(oldPaths[i], newPaths[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newPaths, nil
+}
+
+// Empties a file's contents without deleting it, as long as it is within the safety path.
+// Args:
+//
+//	path(string): The path to the file to truncate.
+//
+// Returns:
+//
+//	error: ErrOutsideSafetyPath if the path was not within the safety path or a *PathError
+//	from os.Truncate, else nil.
+func TruncateSafeFile(path string) (err error) {
+	defer func() { logOperation("TruncateSafeFile", path, err) }()
+
+	target, inSafetyPath, err := withinSafetyPath(path)
+	if err != nil {
+		return err
+	}
+	if inSafetyPath {
+		err := os.Truncate(target, 0)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: file path %s is not within %s", ErrOutsideSafetyPath, path, safetyPath)
+}
+
+// Writes data to a file as long as it is within the safety path.
+// Args:
+//
+//	path(string): The path of the file to write.
+//	data([]byte): The contents to write.
+//	overWrite(bool): To overwrite the file if it already exists in path.
+//
+// Returns:
+//
+//	error: ErrOutsideSafetyPath if the path was not within the safety path, ErrDestExists
+//	if overWrite is false and the file exists, a *PathError from writing the file, else nil.
+func WriteSafeFile(path string, data []byte, overWrite bool) (err error) {
+	defer func() { logOperation("WriteSafeFile", path, err) }()
+
+	target, inSafetyPath, err := withinSafetyPath(path)
+	if err != nil {
+		return err
+	}
+	if !inSafetyPath {
+		return fmt.Errorf("%w: file path %s is not within %s", ErrOutsideSafetyPath, path, safetyPath)
+	}
+
+	file, err := openFileForWrite(target, overWrite)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(data)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Copy everything from a reader into a writer, such as open files, buffers, or network streams.
+// Args:
+//
+//	dst(io.Writer): The writer to copy into.
+//	src(io.Reader): The reader to copy from until EOF.
+//
+// Returns:
+//
+//	int64: The number of bytes copied.
+//	error: Any error from reading or writing, else nil. Reaching EOF is not an error.
+func CopyStream(dst io.Writer, src io.Reader) (int64, error) {
+	return copyStream(dst, src, nil)
+}
+
+// Helper function that copies everything from a reader into a writer through a buffer,
+// shared by CopyStream and the file copy functions.
+// Args:
+//
+//	dst(io.Writer): The writer to copy into.
+//	src(io.Reader): The reader to copy from until EOF.
+//	buf([]byte): The buffer to copy through, nil lets dst or src copy directly when they
+//	support it, such as *os.File, and otherwise allocates a default sized one.
+//
+// Returns:
+//
+//	int64: The number of bytes copied.
+//	error: Any error from reading or writing, else nil. Reaching EOF is not an error.
+func copyStream(dst io.Writer, src io.Reader, buf []byte) (int64, error) {
+	if buf != nil {
+		// Hide io.WriterTo and io.ReaderFrom so io.CopyBuffer has to use the buffer.
+		src = struct{ io.Reader }{src}
+		dst = struct{ io.Writer }{dst}
+	}
+	written, err := io.CopyBuffer(dst, src, buf)
+	if err != nil {
+		return written, err
+	}
+	return written, nil
+}
+
+// Copy file into a separate destination folder, preserving the source's permission bits.
+// Any existing file at the destination is overwritten.
+// Args:
+//
+//	source(string): File path of the file to copy.
+//	dest(string): File path to copy the file too, optionally can have different name.
+//
+// Returns:
+//
+//	error: *PathError crated from os module or possible other error from io module else nil.
+func CopyFile(source string, dest string) (err error) {
+	defer func() { logOperation("CopyFile", source, err) }()
+
+	return copyFile(source, dest, true, 0)
+}
+
+// Copy file into a separate destination folder, preserving the source's permission bits.
+// Args:
+//
+//	source(string): File path of the file to copy.
+//	dest(string): File path to copy the file too, optionally can have different name.
+//	overWrite(bool): To overwrite the destination file if it already exists.
+//
+// Returns:
+//
+//	error: ErrDestExists if overWrite is false and dest exists, *PathError crated from
+//	os module or possible other error from io module else nil.
+func CopyFileOverWrite(source string, dest string, overWrite bool) (err error) {
+	defer func() { logOperation("CopyFileOverWrite", source, err) }()
+
+	return copyFile(source, dest, overWrite, 0)
+}
+
+// The buffer size CopyFileBuffered uses when none is given.
+const defaultCopyBufferSize = 32 * 1024
+
+// Copy file into a separate destination folder, reading and writing through a buffer of
+// the given size. Larger buffers, such as 1MB, reduce system calls when copying very large
+// files. CopyFile lets the platform pick the fastest copy instead, such as an in-kernel
+// copy, so only use this when the buffer size matters.
+// Args:
+//
+//	source(string): File path of the file to copy.
+//	dest(string): File path to copy the file too, optionally can have different name.
+//	bufSize(int): The size in bytes of the copy buffer, values below 1 use the default.
+//
+// Returns:
+//
+//	error: *PathError crated from os module or possible other error from io module else nil.
+func CopyFileBuffered(source string, dest string, bufSize int) (err error) {
+	defer func() { logOperation("CopyFileBuffered", source, err) }()
+
+	if bufSize < 1 {
+		bufSize = defaultCopyBufferSize
+	}
+	return copyFile(source, dest, true, bufSize)
+}
+
+// Helper function that copies a file, preserving the source's permission bits.
+// Args:
+//
+//	source(string): File path of the file to copy.
+//	dest(string): File path to copy the file too.
+//	overWrite(bool): To overwrite the destination file if it already exists.
+//	bufSize(int): The size in bytes of the copy buffer, 0 lets the platform choose how to copy.
+//
+// Returns:
+//
+//	error: ErrDestExists if overWrite is false and dest exists, *PathError crated from
+//	os module or possible other error from io module else nil.
+func copyFile(source string, dest string, overWrite bool, bufSize int) error {
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	destFile, err := openFileForWrite(dest, overWrite)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	var buf []byte
+	if bufSize > 0 {
+		buf = make([]byte, bufSize)
+	}
+	_, err = copyStream(destFile, sourceFile, buf)
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(dest, sourceInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Move a file to a new location, falling back to a copy and delete when the
+// destination is on a different device or volume than the source.
+// Args:
+//
+//	source(string): File path of the file to move.
+//	dest(string): File path to move the file to, optionally can have a different name.
+//
+// Returns:
+//
+//	error: *LinkError from os.Rename, or any error from the copy fallback, else nil.
+//	The source is only removed after a successful copy, and a failed copy leaves any
+//	existing file at dest untouched.
+func MoveFile(source string, dest string) (err error) {
+	defer func() { logOperation("MoveFile", source, err) }()
+
+	err = rename(source, dest)
+	if err == nil {
+		return nil
+	}
+	if !isCrossDeviceError(err) {
+		return err
+	}
+
+	err = copyFileReplace(source, dest)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(source)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Renames files and directories for MoveFile and MoveDirectory, replaceable so tests
+// can simulate a move across devices.
+var rename = os.Rename
+
+// Helper function that copies a file into a temp file beside dest and renames it into
+// place, so a failed copy never touches an existing file at dest.
+// Args:
+//
+//	source(string): File path of the file to copy.
+//	dest(string): File path to copy the file to, replacing any existing file.
+//
+// Returns:
+//
+//	error: Any error from creating the temp file, copying, or renaming, else nil.
+//	The temp file is removed on error.
+func copyFileReplace(source string, dest string) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+
+	err = copyFile(source, tempPath, true, 0)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	err = os.Rename(tempPath, dest)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// Move a directory and its contents to a new location. When the destination does
+// not exist the directory is renamed, otherwise, or when moving across devices, the
+// contents are copied into the destination and the source is removed. Copied files and
+// directories keep their modification times and permissions.
+// Args:
+//
+//	source(string): Folder path of the folder to move.
+//	dest(string): Folder path to move the folder + contents to.
+//	merge(bool): To overwrite files that already exist in the destination, if false
+//	any conflicting file returns an error before anything is copied.
+//
+// Returns:
+//
+//	error: ErrDestExists if merge is false and a file conflicts, any error from the
+//	rename, copy, or removal of the source, else nil.
+func MoveDirectory(source string, dest string, merge bool) (err error) {
+	defer func() { logOperation("MoveDirectory", source, err) }()
+
+	exists, err := pathExists(dest)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		err := rename(source, dest)
+		if err == nil {
+			return nil
+		}
+		if !isCrossDeviceError(err) {
+			return err
+		}
+	}
+
+	opts := CopyOptions{PreserveTimes: true, Symlinks: SymlinkCopy}
+	if !merge {
+		opts.Conflicts = FailOnConflict
+	}
+	err = CopyFolderContentsWithOptions(source, dest, opts)
+	if err != nil {
+		return err
+	}
+	err = copyDirModes(source, dest)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(source)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Helper function that gives every directory in a copied tree the permissions of its
+// source directory, since copies create directories with the default permissions.
+// Args:
+//
+//	source(string): Folder path of the tree that was copied.
+//	dest(string): Folder path the tree was copied to.
+//
+// Returns:
+//
+//	error: Any error from walking the source or changing permissions, else nil.
+func copyDirModes(source string, dest string) error {
+	source = filepath.Clean(source)
+	var dirs []string
+	err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Children are changed before their parents in case a parent becomes unsearchable.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := os.Stat(dirs[i])
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, dirs[i])
+		if err != nil {
+			return err
+		}
+		err = os.Chmod(filepath.Join(dest, rel), info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// How CopyFolderContentsWithOptions handles symlinks found in the source tree.
+type SymlinkPolicy int
+
+const (
+	// Symlinks are not copied.
+	SymlinkSkip SymlinkPolicy = iota
+	// Symlinks are recreated in the destination pointing at the same target.
+	SymlinkCopy
+	// Symlinks are followed and their targets copied, returning an error on a cycle.
+	SymlinkFollow
+)
+
+// How CopyFolderContentsWithOptions handles files that already exist in the destination.
+type ConflictMode int
+
+const (
+	// Existing destination files are overwritten.
+	Overwrite ConflictMode = iota
+	// Existing destination files are left untouched and not copied over.
+	SkipExisting
+	// Any existing destination file returns an error before anything is copied.
+	FailOnConflict
+)
+
+// Options controlling how CopyFolderContentsWithOptions copies a tree.
+type CopyOptions struct {
+	// Set the modification times of copied files and directories to match the source.
+	PreserveTimes bool
+	// How symlinks are handled, defaults to skipping them.
+	Symlinks SymlinkPolicy
+	// How existing destination files are handled, defaults to overwriting them.
+	Conflicts ConflictMode
+}
+
+// Copy contents of a folder to the given destination. Symlinks are skipped.
+// Args:
+//
+//	sourcePath(string): Folder path to the folder that is to be copied.
+//	destination(string): Folder path to copy the folder + contents to.
+//
+// Returns:
+//
+//	error: Any relevant errors created durring process, usually os *PathErrors else nil.
+func CopyFolderContents(sourcePath string, destination string) (err error) {
+	defer func() { logOperation("CopyFolderContents", sourcePath, err) }()
+
+	return copyFolderContents(sourcePath, destination, CopyOptions{})
+}
+
+// Copy contents of a folder to the given destination using the given options.
+// Args:
+//
+//	sourcePath(string): Folder path to the folder that is to be copied.
+//	destination(string): Folder path to copy the folder + contents to.
+//	opts(CopyOptions): Options controlling the copy, the zero value matches CopyFolderContents.
+//
+// Returns:
+//
+//	error: ErrDestExists naming the first conflicting relative path when opts.Conflicts is
+//	FailOnConflict, any relevant errors created durring process, usually os *PathErrors else nil.
+func CopyFolderContentsWithOptions(sourcePath string, destination string, opts CopyOptions) (err error) {
+	defer func() { logOperation("CopyFolderContentsWithOptions", sourcePath, err) }()
+
+	return copyFolderContents(sourcePath, destination, opts)
+}
+
+// Helper function that copies a folder using the given options, shared by
+// CopyFolderContents and CopyFolderContentsWithOptions.
+// Args:
+//
+//	sourcePath(string): Folder path to the folder that is to be copied.
+//	destination(string): Folder path to copy the folder + contents to.
+//	opts(CopyOptions): Options controlling the copy.
+//
+// Returns:
+//
+//	error: ErrDestExists naming the first conflicting relative path when opts.Conflicts is
+//	FailOnConflict, any relevant errors created durring process, usually os *PathErrors else nil.
+func copyFolderContents(sourcePath string, destination string, opts CopyOptions) error {
+	if opts.Conflicts == FailOnConflict {
+		err := findCopyConflict(sourcePath, destination, opts)
+		if err != nil {
+			return err
+		}
+	}
+	return copyFolder(context.Background(), sourcePath, destination, opts, nil)
+}
+
+// Helper function that checks if copying a folder would replace any existing files.
+// Args:
+//
+//	sourcePath(string): Folder path to the folder that is to be copied.
+//	destination(string): Folder path the folder + contents would be copied to.
+//	opts(CopyOptions): Options controlling the copy, used to ignore skipped symlinks.
+//
+// Returns:
+//
+//	error: ErrDestExists naming the first conflicting relative path, any error from
+//	walking the source, else nil.
+func findCopyConflict(sourcePath string, destination string, opts CopyOptions) error {
+	files, err := WalkDirContents(sourcePath, false, false)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		info, err := os.Lstat(filepath.Join(sourcePath, file))
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 && opts.Symlinks == SymlinkSkip {
+			continue
+		}
+
+		conflict, err := entryExists(filepath.Join(destination, file))
+		if err != nil {
+			return err
+		}
+		if conflict {
+			return fmt.Errorf("%w: %s", ErrDestExists, file)
+		}
+	}
+	return nil
+}
+
+// Copy contents of a folder to the given destination, stopping when the context is cancelled.
+// Files copied before cancellation are left in place.
+// Args:
+//
+//	ctx(context.Context): The context checked between each copied file.
+//	sourcePath(string): Folder path to the folder that is to be copied.
+//	destination(string): Folder path to copy the folder + contents to.
+//
+// Returns:
+//
+//	error: ctx.Err() if the context was cancelled, any relevant errors created durring
+//	process, usually os *PathErrors else nil.
+func CopyFolderContentsContext(ctx context.Context, sourcePath string, destination string) (err error) {
+	defer func() { logOperation("CopyFolderContentsContext", sourcePath, err) }()
+
+	return copyFolder(ctx, sourcePath, destination, CopyOptions{}, nil)
+}
+
+// Helper function that recursively copies a folder, checking the context before each item.
+// Args:
+//
+//	ctx(context.Context): The context checked between each copied item.
+//	sourcePath(string): Folder path to the folder that is to be copied.
+//	destination(string): Folder path to copy the folder + contents to.
+//	opts(CopyOptions): Options controlling the copy.
+//	ancestors(map[string]bool): Resolved paths of the folders currently being copied,
+//	used to detect symlink cycles. May be nil.
+//
+// Returns:
+//
+//	error: ctx.Err() if the context was cancelled, any relevant errors created durring
+//	process, usually os *PathErrors else nil.
+func copyFolder(ctx context.Context, sourcePath string, destination string, opts CopyOptions, ancestors map[string]bool) error {
+	sourcePath = filepath.Clean(sourcePath)
+	destination = filepath.Clean(destination)
+
+	if ancestors == nil {
+		ancestors = make(map[string]bool)
+	}
+	realPath, err := filepath.EvalSymlinks(sourcePath)
+	if err != nil {
+		return err
+	}
+	if ancestors[realPath] {
+		return fmt.Errorf("%w: %s", ErrSymlinkCycle, sourcePath)
+	}
+	ancestors[realPath] = true
+	defer delete(ancestors, realPath)
+
+	err = CreateDirectory(destination)
+	if err != nil {
+		return err
+	}
+
+	curItems, err := GetDirContents(sourcePath, false)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range curItems {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		curItemPath := filepath.Clean(filepath.Join(sourcePath, item))
+		destPath := filepath.Clean(filepath.Join(destination, item))
+
+		info, err := os.Lstat(curItemPath)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			switch opts.Symlinks {
+			case SymlinkSkip:
+				continue
+			case SymlinkCopy:
+				target, err := os.Readlink(curItemPath)
+				if err != nil {
+					return err
+				}
+				exists, err := entryExists(destPath)
+				if err != nil {
+					return err
+				}
+				if exists {
+					switch opts.Conflicts {
+					case SkipExisting:
+						continue
+					case FailOnConflict:
+						return fmt.Errorf("%w: %s", ErrDestExists, destPath)
+					}
+					err := os.Remove(destPath)
+					if err != nil {
+						return err
+					}
+				}
+				err = os.Symlink(target, destPath)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		dir, err := isDir(curItemPath)
+		if err != nil {
+			return err
+		}
+		if dir {
+			err := copyFolder(ctx, curItemPath, destPath, opts, ancestors)
+			if err != nil {
+				return err
+			}
+		} else {
+			if opts.Conflicts == SkipExisting {
+				exists, err := entryExists(destPath)
+				if err != nil {
+					return err
+				}
+				if exists {
+					continue
+				}
+			}
+			err := CopyFileOverWrite(curItemPath, destPath, opts.Conflicts == Overwrite)
+			if err != nil {
+				return err
+			}
+			if opts.PreserveTimes {
+				err := copyModTime(curItemPath, destPath)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Directory times are set last since copying contents into it updates its mtime.
+	if opts.PreserveTimes {
+		err := copyModTime(sourcePath, destination)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copy contents of a folder to the given destination using a pool of workers.
+// The directory structure is created first and then files are copied concurrently,
+// symlinks are skipped the same as CopyFolderContents.
+// Args:
+//
+//	sourcePath(string): Folder path to the folder that is to be copied.
+//	destination(string): Folder path to copy the folder + contents to.
+//	workers(int): The number of files to copy at once, values below 1 use a single worker.
+//
+// Returns:
+//
+//	error: The first error created durring process, usually os *PathErrors else nil.
+//	Remaining copies are abandoned once an error occurs.
+func CopyFolderContentsParallel(sourcePath string, destination string, workers int) (err error) {
+	defer func() { logOperation("CopyFolderContentsParallel", sourcePath, err) }()
+
+	sourcePath = filepath.Clean(sourcePath)
+	destination = filepath.Clean(destination)
+	if workers < 1 {
+		workers = 1
+	}
+
+	var files []string
+	err = filepath.WalkDir(sourcePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourcePath, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return CreateDirectoryAll(filepath.Join(destination, rel))
+		}
+		if d.Type().IsRegular() {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var firstErr error
+	var errOnce sync.Once
+	var wg sync.WaitGroup
+	jobs := make(chan string)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range jobs {
+				err := CopyFile(filepath.Join(sourcePath, rel), filepath.Join(destination, rel))
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	for _, rel := range files {
+		select {
+		case jobs <- rel:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
+
+// Helper function that sets the access and modification times of dest to the
+// modification time of source.
+// Args:
+//
+//	source(string): The path to read the modification time from.
+//	dest(string): The path to apply the modification time to.
+//
+// Returns:
+//
+//	error: Any *PathError from os.Stat or os.Chtimes, else nil.
+func copyModTime(source string, dest string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dest, info.ModTime(), info.ModTime())
+}
+
+// Sets a function that receives an event at the end of each copy, move, delete,
+// rename, and safe write operation. The op is the name of the function, such as
+// "CopyFile", the path is its first path argument, and err is the error it returned.
+// Passing nil restores the default no-op. Set it before running operations concurrently.
+// Args:
+//
+//	fn(func(op string, path string, err error)): The function receiving the events.
+func SetLogger(fn func(op string, path string, err error)) {
+	if fn == nil {
+		fn = func(string, string, error) {}
+	}
+	logger = fn
+}
+
+// Helper function that sends an operation event to the registered logger.
+// Args:
+//
+//	op(string): The name of the operation.
+//	path(string): The path the operation acted on.
+//	err(error): The error the operation returned, nil on success.
+func logOperation(op string, path string, err error) {
+	logger(op, path, err)
+}
+
+// Sets the function used to get the current time for GetDate, GetTime, and the
+// functions that name things by date. Passing nil restores the default time.Now.
+// Args:
+//
+//	now(func() time.Time): The function returning the current time.
+func SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	clock = now
+}
+
+// Returns string: 'yyyymmdd'.
+func GetDate() string {
+	return clock().Format("20060102")
+}
+
+// Returns string: 'HH:MM:SS:00', the trailing '00' is a literal kept for compatibility.
+// Use GetTimeMicro for real sub-second precision.
+func GetTime() string {
+	return clock().Format("15:04:05:00")
+}
+
+// Returns string: 'HH:MM:SS.XXXXXX', X is microsecond.
+func GetTimeMicro() string {
+	return clock().Format("15:04:05.000000")
+}
+
+// Exports a string map to json file path.
+// Args:
+//
+//	fielpath(string): The file path to place the .json file.
+//	data(map[string]interface{}): Any map with string keys and values that can be converted to strings.
+//	overWrite(bool): To overwrite json file if it already exists in path.
+//
+// Returns:
+//
+//	error: Any relevant error from the json handling or file writing process.
+func ExportMapToJson(filePath string, data map[string]interface{}, overWrite bool) error {
+	return ExportStructToJson(filePath, data, overWrite)
+}
+
+// Exports any json serializable value, such as a struct, to a json file path.
+// Args:
+//
+//	filePath(string): The file path to place the .json file.
+//	data(T): Any value that can be encoded by encoding/json.
+//	overWrite(bool): To overwrite json file if it already exists in path.
+//
+// Returns:
+//
+//	error: Any relevant error from the json handling or file writing process.
+func ExportStructToJson[T any](filePath string, data T, overWrite bool) error {
+	return writeJson(filePath, data, overWrite, "")
+}
+
+// Exports a string map to a human readable, indented json file path.
+// Args:
+//
+//	filePath(string): The file path to place the .json file.
+//	data(map[string]interface{}): Any map with string keys and values that can be converted to strings.
+//	overWrite(bool): To overwrite json file if it already exists in path.
+//	indent(string): The string used for each level of indentation, such as "  ".
+//
+// Returns:
+//
+//	error: Any relevant error from the json handling or file writing process.
+func ExportMapToJsonIndent(filePath string, data map[string]interface{}, overWrite bool, indent string) error {
+	return ExportStructToJsonIndent(filePath, data, overWrite, indent)
+}
+
+// Exports any json serializable value to a human readable, indented json file path.
+// Args:
+//
+//	filePath(string): The file path to place the .json file.
+//	data(T): Any value that can be encoded by encoding/json.
+//	overWrite(bool): To overwrite json file if it already exists in path.
+//	indent(string): The string used for each level of indentation, such as "  ".
+//
+// Returns:
+//
+//	error: Any relevant error from the json handling or file writing process.
+func ExportStructToJsonIndent[T any](filePath string, data T, overWrite bool, indent string) error {
+	return writeJson(filePath, data, overWrite, indent)
+}
+
+// Exports a string map to a json file path, writing the keys in the given order
+// rather than the sorted order json.Marshal uses for maps.
+// Args:
+//
+//	filePath(string): The file path to place the .json file.
+//	keys([]string): The keys of data in the order they should be written.
+//	data(map[string]interface{}): Any map with string keys and values that can be converted to strings.
+//	overWrite(bool): To overwrite json file if it already exists in path.
+//
+// Returns:
+//
+//	error: An error if keys contains a duplicate or a key missing from data, if data
+//	has a key not listed in keys, or any relevant error from the json handling or
+//	file writing process.
+func ExportOrderedToJson(filePath string, keys []string, data map[string]interface{}, overWrite bool) error {
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			return fmt.Errorf("duplicate key %q", key)
+		}
+		if _, ok := data[key]; !ok {
+			return fmt.Errorf("key %q not found in data", key)
+		}
+		seen[key] = true
+	}
+
+	for key := range data {
+		if !seen[key] {
+			return fmt.Errorf("key %q missing from key order", key)
+		}
+	}
+
+	return writeJson(filePath, orderedMap{keys: keys, data: data}, overWrite, "")
+}
+
+// A map paired with the order its keys should be encoded in.
+type orderedMap struct {
+	keys []string
+	data map[string]interface{}
+}
+
+// Encodes the map as a json object with its keys in order.
+func (m orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		encodedValue, err := json.Marshal(m.data[key])
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(encodedValue)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Helper function that encodes data as json and writes it to the file path.
+// Args:
+//
+//	filePath(string): The file path to place the .json file.
+//	data(any): Any value that can be encoded by encoding/json.
+//	overWrite(bool): To overwrite json file if it already exists in path.
+//	indent(string): The indentation per level, an empty string writes compact json.
+//
+// Returns:
+//
+//	error: Any relevant error from the json handling or file writing process.
+func writeJson(filePath string, data any, overWrite bool, indent string) error {
+	exists, err := pathExists(filePath)
+	if err != nil {
+		return err
+	}
+
+	if !exists || overWrite {
+		var jsonData []byte
+		if indent == "" {
+			jsonData, err = json.Marshal(data)
+		} else {
+			jsonData, err = json.MarshalIndent(data, "", indent)
+		}
+		if err != nil {
+			return err
+		}
+
+		return writeFileAtomic(filePath, jsonData)
+	}
+	return nil
+}
+
+// Writes data to the temp file used by writeFileAtomic, replaceable so tests can
+// simulate a failed write.
+var writeTemp = func(file *os.File, data []byte) error {
+	_, err := file.Write(data)
+	return err
+}
+
+// Helper function that writes data to a temp file in the same directory as the
+// file path and renames it into place, so a failed write never leaves a partial file.
+// An existing file's permissions are kept, new files are created with 0644.
+// Args:
+//
+//	filePath(string): The file path to write.
+//	data([]byte): The full contents of the file.
+//
+// Returns:
+//
+//	error: Any error from writing or renaming the temp file, else nil. The temp
+//	file is removed on error.
+func writeFileAtomic(filePath string, data []byte) error {
+	perm := os.FileMode(0644)
+	info, err := os.Stat(filePath)
+	if err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+
+	err = writeTemp(tempFile, data)
+	if err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	err = tempFile.Close()
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	err = os.Chmod(tempPath, perm)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	err = os.Rename(tempPath, filePath)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// Merges a string map into an existing json file, with the new values replacing any
+// existing keys. If the file does not exist it is created like ExportMapToJson.
+// Args:
+//
+//	filePath(string): The file path of the .json file to merge into.
+//	data(map[string]interface{}): The keys and values to merge over the existing object.
+//
+// Returns:
+//
+//	error: A wrapped ErrInvalidJson if the existing file is malformed, any relevant error
+//	from the json handling or file writing process, else nil.
+func MergeMapToJson(filePath string, data map[string]interface{}) error {
+	exists, err := pathExists(filePath)
+	if err != nil {
+		return err
+	}
+
+	merged := make(map[string]interface{})
+	if exists {
+		existing, err := ImportJsonToMap(filePath)
+		if err != nil {
+			return err
+		}
+		for key, value := range existing {
+			merged[key] = value
+		}
+	}
+	for key, value := range data {
+		merged[key] = value
+	}
+	return ExportMapToJson(filePath, merged, true)
+}
+
+// Imports a json file into a string map, the inverse of ExportMapToJson.
+// Args:
+//
+//	filePath(string): The file path of the .json file to read.
+//
+// Returns:
+//
+//	map[string]interface{}: The decoded json object.
+//	error: A wrapped fs.ErrNotExist if the file does not exist, a wrapped ErrInvalidJson
+//	if the contents are malformed, or any other error from reading the file, else nil.
+func ImportJsonToMap(filePath string) (map[string]interface{}, error) {
+	return ImportStructFromJson[map[string]interface{}](filePath)
+}
+
+// Imports a json file into any json deserializable type, the inverse of ExportStructToJson.
+// Args:
+//
+//	filePath(string): The file path of the .json file to read.
+//
+// Returns:
+//
+//	T: The decoded json value.
+//	error: A wrapped fs.ErrNotExist if the file does not exist, a wrapped ErrInvalidJson
+//	if the contents are malformed, or any other error from reading the file, else nil.
+func ImportStructFromJson[T any](filePath string) (T, error) {
+	var data T
+
+	jsonData, err := os.ReadFile(filePath)
+	if err != nil {
+		return data, fmt.Errorf("reading json file: %w", err)
+	}
+
+	err = json.Unmarshal(jsonData, &data)
+	if err != nil {
+		var zero T
+		return zero, fmt.Errorf("%w: %s: %w", ErrInvalidJson, filePath, err)
+	}
+	return data, nil
+}
+
+// Imports a json file into any json deserializable type, falling back to a default
+// value when the file does not exist.
+// Args:
+//
+//	filePath(string): The file path of the .json file to read.
+//	def(T): The value to return if the file does not exist.
+//
+// Returns:
+//
+//	T: The decoded json value, or def if the file does not exist.
+//	error: A wrapped ErrInvalidJson if the contents are malformed, or any other error
+//	from reading the file besides it not existing, else nil.
+func ImportJsonOrDefault[T any](filePath string, def T) (T, error) {
+	data, err := ImportStructFromJson[T](filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return def, nil
+	}
+	return data, err
+}
+
+// Imports a json file whose top level is an array into a typed slice.
+// Args:
+//
+//	filePath(string): The file path of the .json file to read.
+//
+// Returns:
+//
+//	[]T: The decoded array elements.
+//	error: A wrapped fs.ErrNotExist if the file does not exist, a wrapped ErrInvalidJson
+//	if the top level is not an array or the contents are malformed, or any other error
+//	from reading the file, else nil.
+func ImportJsonArray[T any](filePath string) ([]T, error) {
+	jsonData, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading json file: %w", err)
+	}
+
+	trimmed := bytes.TrimSpace(jsonData)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return nil, fmt.Errorf("%w: %s: top level is not an array", ErrInvalidJson, filePath)
+	}
+
+	var data []T
+	err = json.Unmarshal(trimmed, &data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidJson, filePath, err)
+	}
+	return data, nil
+}
+
+// Hashes the contents of a file, streaming it through the hasher so large files
+// are never fully loaded into memory.
+// Args:
+//
+//	path(string): The file path of the file to hash.
+//	algo(string): The hash algorithm to use, one of "md5", "sha1", or "sha256".
+//
+// Returns:
+//
+//	string: The lowercase hex digest of the file contents.
+//	error: ErrUnsupportedAlgorithm for an unknown algorithm, or any error from reading the file, else nil.
+func HashFile(path string, algo string) (string, error) {
+	var hasher hash.Hash
+	switch strings.ToLower(algo) {
+	case "md5":
+		hasher = md5.New()
+	case "sha1":
+		hasher = sha1.New()
+	case "sha256":
+		hasher = sha256.New()
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algo)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Compares two directory trees for the same relative files with identical contents.
+// Files are compared by size first and then by sha256 hash when the sizes match.
+// Args:
+//
+//	a(string): Folder path of the first tree.
+//	b(string): Folder path of the second tree.
+//
+// Returns:
+//
+//	bool: True if both trees contain the same files with the same contents else false.
+//	[]string: Sorted relative paths of files that differ or only exist in one tree.
+//	error: Any error created while walking the trees or reading files, else nil.
+func DirectoriesEqual(a string, b string) (bool, []string, error) {
+	aFiles, err := WalkDirContents(a, false, false)
+	if err != nil {
+		return false, nil, err
+	}
+	bFiles, err := WalkDirContents(b, false, false)
+	if err != nil {
+		return false, nil, err
+	}
+
+	inB := make(map[string]bool, len(bFiles))
+	for _, file := range bFiles {
+		inB[file] = true
+	}
+
+	var diffs []string
+	for _, file := range aFiles {
+		if !inB[file] {
+			diffs = append(diffs, file)
+			continue
+		}
+		delete(inB, file)
+
+		same, err := filesEqual(filepath.Join(a, file), filepath.Join(b, file))
+		if err != nil {
+			return false, nil, err
+		}
+		if !same {
+			diffs = append(diffs, file)
+		}
+	}
+	for file := range inB {
+		diffs = append(diffs, file)
+	}
+
+	sort.Strings(diffs)
+	return len(diffs) == 0, diffs, nil
+}
+
+// Helper function that compares two files by size and then by sha256 hash.
+// Symlinks are not followed, two symlinks are equal when they share the same target.
+// Args:
+//
+//	a(string): File path of the first file.
+//	b(string): File path of the second file.
+//
+// Returns:
+//
+//	bool: True if the files have identical contents else false.
+//	error: Any error created while reading either file, else nil.
+func filesEqual(a string, b string) (bool, error) {
+	aInfo, err := os.Lstat(a)
+	if err != nil {
+		return false, err
+	}
+	bInfo, err := os.Lstat(b)
+	if err != nil {
+		return false, err
+	}
+
+	aLink := aInfo.Mode()&os.ModeSymlink != 0
+	bLink := bInfo.Mode()&os.ModeSymlink != 0
+	if aLink || bLink {
+		if aLink != bLink {
+			return false, nil
+		}
+		aTarget, err := os.Readlink(a)
+		if err != nil {
+			return false, err
+		}
+		bTarget, err := os.Readlink(b)
+		if err != nil {
+			return false, err
+		}
+		return aTarget == bTarget, nil
+	}
+
+	if aInfo.Size() != bInfo.Size() {
+		return false, nil
+	}
+
+	aHash, err := HashFile(a, "sha256")
+	if err != nil {
+		return false, err
+	}
+	bHash, err := HashFile(b, "sha256")
+	if err != nil {
+		return false, err
+	}
+	return aHash == bHash, nil
+}
+
+// Appends data to the end of a file, creating the file if it does not exist.
+// Args:
+//
+//	path(string): The file path to append to.
+//	data([]byte): The bytes to append.
+//
+// Returns:
+//
+//	error: *PathError from opening or writing the file, else nil.
+func AppendToFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(data)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Copy file into a separate destination folder, reporting progress as each chunk is written.
+// Args:
+//
+//	source(string): File path of the file to copy.
+//	dest(string): File path to copy the file too, optionally can have different name.
+//	progress(func(copied, total int64)): Called after every chunk is written and once more
+//	when the copy completes, copied never decreases between calls.
+//
+// Returns:
+//
+//	error: *PathError crated from os module or possible other error from io module else nil.
+func CopyFileProgress(source string, dest string, progress func(copied, total int64)) (err error) {
+	defer func() { logOperation("CopyFileProgress", source, err) }()
+
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	destFile, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	writer := &progressWriter{writer: destFile, total: sourceInfo.Size(), progress: progress}
+	_, err = CopyStream(writer, sourceFile)
+	if err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(writer.copied, writer.total)
+	}
+
+	err = os.Chmod(dest, sourceInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Writer that reports the running byte count to a callback after every write.
+type progressWriter struct {
+	writer   io.Writer
+	copied   int64
+	total    int64
+	progress func(copied, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.writer.Write(b)
+	p.copied += int64(n)
+	if p.progress != nil {
+		p.progress(p.copied, p.total)
+	}
+	return n, err
+}
+
+// Extracts a zip archive into a destination directory. Any entry that would be
+// extracted outside of destDir, such as one containing "../", is refused.
+// Args:
+//
+//	srcZip(string): File path of the zip archive to extract.
+//	destDir(string): Folder path to extract the archive contents into.
+//
+// Returns:
+//
+//	error: ErrPathEscapes if an entry escapes destDir, any error from reading the
+//	archive or writing its contents, else nil.
+func Unzip(srcZip string, destDir string) error {
+	reader, err := zip.OpenReader(srcZip)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	destDir = filepath.Clean(destDir)
+	err = CreateDirectoryAll(destDir)
+	if err != nil {
+		return err
+	}
+
+	// Directory permissions are applied last so they are kept when an earlier entry
+	// already created the directory, and so read-only directories can still be filled.
+	dirModes := make(map[string]fs.FileMode)
+	var dirs []string
+
+	for _, entry := range reader.File {
+		destPath := filepath.Join(destDir, entry.Name)
+		inDest, err := isWithin(destDir, destPath)
+		if err != nil {
+			return err
+		}
+		if !inDest {
+			return fmt.Errorf("%w: zip entry %s escapes %s", ErrPathEscapes, entry.Name, destDir)
+		}
+
+		if entry.FileInfo().IsDir() {
+			err := CreateDirectoryAll(destPath)
+			if err != nil {
+				return err
+			}
+			_, found := dirModes[destPath]
+			if !found {
+				dirs = append(dirs, destPath)
+			}
+			dirModes[destPath] = entry.Mode().Perm()
+			continue
+		}
+
+		err = CreateDirectoryAll(filepath.Dir(destPath))
+		if err != nil {
+			return err
+		}
+		err = unzipFile(entry, destPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err := os.Chmod(dirs[i], dirModes[dirs[i]])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper function that writes a single zip entry to a file path with the entry's mode.
+// Args:
+//
+//	entry(*zip.File): The archive entry to extract.
+//	destPath(string): File path to write the entry contents to.
+//
+// Returns:
+//
+//	error: Any error from reading the entry or writing the file, else nil.
+func unzipFile(entry *zip.File, destPath string) error {
+	entryReader, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer entryReader.Close()
+
+	destFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	_, err = CopyStream(destFile, entryReader)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Archives a directory into a gzip compressed tarball, storing each entry's path relative
+// to the directory and its permissions. Only directories and regular files are archived,
+// and an archive written inside the directory skips itself. A failed archive is removed.
+// Args:
+//
+//	sourceDir(string): Folder path of the directory to archive.
+//	destTarGz(string): File path to write the .tar.gz archive to.
+//
+// Returns:
+//
+//	error: Any error from walking the directory, reading its files or writing the
+//	archive, else nil.
+func TarGzDirectory(sourceDir string, destTarGz string) (err error) {
+	destFile, err := os.Create(destTarGz)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := destFile.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(destTarGz)
+		}
+	}()
+
+	destInfo, err := destFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	gzipWriter := gzip.NewWriter(destFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	sourceDir = filepath.Clean(sourceDir)
+	err = filepath.WalkDir(sourceDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == sourceDir {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if (!info.IsDir() && !info.Mode().IsRegular()) || os.SameFile(info, destInfo) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = CopyStream(tarWriter, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// Extracts a gzip compressed tarball into a destination directory, restoring the
+// permissions of each entry. Any entry that would be extracted outside of destDir,
+// such as one containing "../", is refused. Entries other than directories and
+// regular files, such as symlinks, are skipped.
+// Args:
+//
+//	src(string): File path of the .tar.gz archive to extract.
+//	destDir(string): Folder path to extract the archive contents into.
+//
+// Returns:
+//
+//	error: ErrPathEscapes if an entry escapes destDir, any error from reading the
+//	archive or writing its contents, else nil.
+func UntarGz(src string, destDir string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	gzipReader, err := gzip.NewReader(srcFile)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	destDir = filepath.Clean(destDir)
+	err = CreateDirectoryAll(destDir)
+	if err != nil {
+		return err
+	}
+
+	// Directory permissions are applied last so read-only directories can still be filled.
+	dirModes := make(map[string]fs.FileMode)
+	var dirs []string
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		destPath := filepath.Join(destDir, header.Name)
+		inDest, err := isWithin(destDir, destPath)
+		if err != nil {
+			return err
+		}
+		if !inDest {
+			return fmt.Errorf("%w: tar entry %s escapes %s", ErrPathEscapes, header.Name, destDir)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err := CreateDirectoryAll(destPath)
+			if err != nil {
+				return err
+			}
+			_, found := dirModes[destPath]
+			if !found {
+				dirs = append(dirs, destPath)
+			}
+			dirModes[destPath] = header.FileInfo().Mode().Perm()
+		case tar.TypeReg:
+			err := CreateDirectoryAll(filepath.Dir(destPath))
+			if err != nil {
+				return err
+			}
+			err = untarFile(tarReader, destPath, header.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err := os.Chmod(dirs[i], dirModes[dirs[i]])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper function that writes the current tar entry to a file path with the given mode.
+// Args:
+//
+//	reader(io.Reader): The archive reader positioned at the entry to extract.
+//	destPath(string): File path to write the entry contents to.
+//	mode(fs.FileMode): The permissions to give the written file.
+//
+// Returns:
+//
+//	error: Any error from reading the entry or writing the file, else nil.
+func untarFile(reader io.Reader, destPath string, mode fs.FileMode) error {
+	destFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	_, err = CopyStream(destFile, reader)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(destPath, mode)
+}
+
+// Appends the OS path separator to a path if it does not already end with one.
+// Args:
+//
+//	path(string): The directory path to normalize.
+//
+// Returns:
+//
+//	string: The path ending with a separator, an empty path is returned unchanged.
+func EnsureTrailingSeparator(path string) string {
+	if path == "" || os.IsPathSeparator(path[len(path)-1]) {
+		return path
+	}
+	return path + string(os.PathSeparator)
+}
+
+// Removes any trailing path separators from a path, the inverse of EnsureTrailingSeparator.
+// Root paths such as "/" or "C:\" are returned unchanged.
+// Args:
+//
+//	path(string): The directory path to normalize.
+//
+// Returns:
+//
+//	string: The path without trailing separators.
+func TrimTrailingSeparator(path string) string {
+	root := len(filepath.VolumeName(path)) + 1
+	for len(path) > root && os.IsPathSeparator(path[len(path)-1]) {
+		path = path[:len(path)-1]
+	}
+	return path
+}
+
+// Creates a new temporary directory along with a function that removes it.
+// Args:
+//
+//	prefix(string): The prefix of the temporary directory name.
+//
+// Returns:
+//
+//	string: The path of the created temporary directory.
+//	func(): Removes the directory and its contents, safe to call multiple times.
+//	error: Any error from os.MkdirTemp, else nil.
+func CreateTempDir(prefix string) (string, func(), error) {
+	path, err := os.MkdirTemp("", prefix)
+	if err != nil {
+		return "", func() {}, err
+	}
+
+	var once sync.Once
+	cleanup := func() {
+		once.Do(func() {
+			os.RemoveAll(path)
+		})
+	}
+	return path, cleanup, nil
+}
+
+// Finds every file beneath a directory whose name matches a glob pattern.
+// Directories are searched but never included in the results.
+// Args:
+//
+//	root(string): Folder path to search beneath.
+//	pattern(string): Glob pattern, matched with filepath.Match against each file name.
+//
+// Returns:
+//
+//	[]string: Full paths of the matching files.
+//	error: Any error from walking the tree or a malformed pattern, else nil.
+func FindFiles(root string, pattern string) ([]string, error) {
+	_, err := filepath.Match(pattern, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		matched, _ := filepath.Match(pattern, d.Name())
+		if matched {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// Reads a text file into a slice of lines, handling both "\n" and "\r\n" line endings.
+// Args:
+//
+//	path(string): The file path of the text file to read.
+//
+// Returns:
+//
+//	[]string: The lines of the file without their line endings.
+//	error: Any error from opening or scanning the file, else nil.
+func ReadLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// Writes lines to a text file, ending each line with the OS line ending.
+// Args:
+//
+//	path(string): The file path to write the lines to.
+//	lines([]string): The lines to write.
+//	overWrite(bool): To overwrite the file if it already exists in path.
+//
+// Returns:
+//
+//	error: ErrDestExists if overWrite is false and the file exists, any *PathError
+//	from writing the file, else nil.
+func WriteLines(path string, lines []string, overWrite bool) error {
+	file, err := openFileForWrite(path, overWrite)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, line := range lines {
+		_, err := writer.WriteString(line + lineEnding)
+		if err != nil {
+			return err
+		}
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Metadata describing a file or directory, returned by Info.
+type FileMeta struct {
+	Name     string
+	FullPath string
+	Size     int64
+	IsDir    bool
+	ModTime  time.Time
+	Mode     os.FileMode
+}
+
+// Gets the metadata of a file or directory.
+// Args:
+//
+//	path(string): The path of the file or directory.
+//
+// Returns:
+//
+//	FileMeta: The name, absolute path, size, type, modification time, and mode of the path.
+//	error: A wrapped fs.ErrNotExist if the path does not exist, any other error from
+//	os.Stat or resolving the absolute path, else nil.
+func Info(path string) (FileMeta, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileMeta{}, fmt.Errorf("getting info for %s: %w", path, err)
+	}
+
+	fullPath, err := filepath.Abs(path)
+	if err != nil {
+		return FileMeta{}, err
+	}
+
+	meta := FileMeta{
+		Name:     info.Name(),
+		FullPath: fullPath,
+		Size:     info.Size(),
+		IsDir:    info.IsDir(),
+		ModTime:  info.ModTime(),
+		Mode:     info.Mode(),
+	}
+	return meta, nil
+}
+
+// Creates an empty file if it does not exist, otherwise updates its access and
+// modification times to now, like the Unix touch command.
+// Args:
+//
+//	path(string): The file path to touch.
+//
+// Returns:
+//
+//	error: Any *PathError from os.Create or os.Chtimes, else nil.
+func Touch(path string) error {
+	exists, err := pathExists(path)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		now := time.Now()
+		err := os.Chtimes(path, now, now)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Copies many files, attempting every pair instead of stopping at the first failure.
+// Args:
+//
+//	pairs([][2]string): The source and destination file paths of each copy.
+//
+// Returns:
+//
+//	map[string]error: The error of each failed copy keyed by its source path.
+//	error: A custom error if any pair has an empty source or destination, in which
+//	case nothing is copied, else nil.
+func CopyFiles(pairs [][2]string) (map[string]error, error) {
+	for i, pair := range pairs {
+		if pair[0] == "" || pair[1] == "" {
+			errorMsg := fmt.Sprintf("copy pair %d has an empty source or destination", i)
+			return nil, errors.New(errorMsg)
+		}
+	}
+
+	failures := make(map[string]error)
+	for _, pair := range pairs {
+		err := CopyFile(pair[0], pair[1])
+		if err != nil {
+			failures[pair[0]] = err
+		}
+	}
+	return failures, nil
+}
+
+// Determines if a directory has no entries.
+// Args:
+//
+//	path(string): The directory path to check.
+//
+// Returns:
+//
+//	bool: True if the directory has no entries else false.
+//	error: A *PathError if the path does not exist or is not a directory, else nil.
+func IsDirEmpty(path string) (bool, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer dir.Close()
+
+	_, err = dir.Readdirnames(1)
+	if errors.Is(err, io.EOF) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// Makes a destination directory an exact copy of a source directory. New or changed
+// files are copied, with changes detected by size and modification time, and anything
+// in the destination that no longer exists in the source is deleted. Only directories
+// and regular files are mirrored, the destination must be within the safety path.
+// Args:
+//
+//	source(string): Folder path of the source of truth.
+//	dest(string): Folder path to mirror the source into.
+//
+// Returns:
+//
+//	error: ErrOutsideSafetyPath if dest is not within the safety path, any error created
+//	while copying or deleting, else nil.
+func MirrorDirectory(source string, dest string) (err error) {
+	defer func() { logOperation("MirrorDirectory", source, err) }()
+
+	target, inSafetyPath, err := withinSafetyPath(dest)
+	if err != nil {
+		return err
+	}
+	if !inSafetyPath {
+		return fmt.Errorf("%w: folder path %s is not within %s", ErrOutsideSafetyPath, dest, safetyPath)
+	}
+
+	err = CreateDirectoryAll(target)
+	if err != nil {
+		return err
+	}
+
+	sourceItems, err := WalkDirContents(source, false, true)
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(sourceItems))
+	for _, item := range sourceItems {
+		sourcePath := filepath.Join(source, item)
+		destPath := filepath.Join(target, item)
+
+		sourceInfo, err := os.Lstat(sourcePath)
+		if err != nil {
+			return err
+		}
+		if !sourceInfo.IsDir() && !sourceInfo.Mode().IsRegular() {
+			continue
+		}
+		keep[item] = true
+
+		destInfo, err := os.Lstat(destPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// A destination entry of a different kind, such as a symlink, is removed rather
+		// than copied through, so nothing outside dest is ever written to.
+		mismatched := destInfo != nil && (destInfo.IsDir() != sourceInfo.IsDir() ||
+			!destInfo.IsDir() && !destInfo.Mode().IsRegular())
+		if mismatched {
+			err := os.RemoveAll(destPath)
+			if err != nil {
+				return err
+			}
+			destInfo = nil
+		}
+
+		if sourceInfo.IsDir() {
+			err := CreateDirectoryAll(destPath)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if destInfo != nil && destInfo.Size() == sourceInfo.Size() && destInfo.ModTime().Equal(sourceInfo.ModTime()) {
+			continue
+		}
+		err = CopyFile(sourcePath, destPath)
+		if err != nil {
+			return err
+		}
+		err = copyModTime(sourcePath, destPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	destItems, err := WalkDirContents(target, false, true)
+	if err != nil {
+		return err
+	}
+	for _, item := range destItems {
+		if keep[item] {
+			continue
+		}
+		err := os.RemoveAll(filepath.Join(target, item))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The name of the folder within the safety path that trashed items are moved into.
+const trashDirName = ".trash"
+
+// Moves a file into a timestamped folder in the safety path's trash instead of deleting it.
+// Args:
+//
+//	path(string): The file path to trash, must be within the safety path.
+//
+// Returns:
+//
+//	error: ErrOutsideSafetyPath if the path was not within the safety path, any
+//	error from MoveFile, else nil.
+func TrashFile(path string) error {
+	source, dest, err := trashDestination(path)
+	if err != nil {
+		return err
+	}
+	return MoveFile(source, dest)
+}
+
+// Moves a directory into a timestamped folder in the safety path's trash instead of deleting it.
+// Args:
+//
+//	path(string): The folder path to trash, must be within the safety path.
+//
+// Returns:
+//
+//	error: ErrOutsideSafetyPath if the path was not within the safety path, any
+//	error from MoveDirectory, else nil.
+func TrashDirectory(path string) error {
+	source, dest, err := trashDestination(path)
+	if err != nil {
+		return err
+	}
+	return MoveDirectory(source, dest, false)
+}
+
+// Permanently deletes everything in the safety path's trash.
+// Returns:
+//
+//	error: The *PathError created from os.RemoveAll if one was created, else nil.
+func EmptyTrash() (err error) {
+	trashDir := filepath.Join(safetyPath, trashDirName)
+	defer func() { logOperation("EmptyTrash", trashDir, err) }()
+
+	return os.RemoveAll(trashDir)
+}
+
+// Helper function that validates a path is within the safety path and creates
+// the timestamped trash folder it will be moved into.
+// Args:
+//
+//	path(string): The path that is being trashed.
+//
+// Returns:
+//
+//	string: The resolved path of the item to move.
+//	string: The path to move the item to.
+//	error: ErrOutsideSafetyPath if the path was not within the safety path, any
+//	error from creating the trash folder, else nil.
+func trashDestination(path string) (string, string, error) {
+	target, inSafetyPath, err := withinSafetyPath(path)
+	if err != nil {
+		return "", "", err
+	}
+	if !inSafetyPath {
+		return "", "", fmt.Errorf("%w: path %s is not within %s", ErrOutsideSafetyPath, path, safetyPath)
+	}
+
+	stamp := clock().Format("20060102-150405.000000000")
+	trashDir := filepath.Join(safetyPath, trashDirName, stamp)
+	err = CreateDirectoryAll(trashDir)
+	if err != nil {
+		return "", "", err
+	}
+	return target, filepath.Join(trashDir, filepath.Base(target)), nil
+}
+
+// Writes a checksum manifest of every regular file beneath a directory, one "hash  relative/path"
+// line per file in the same format as sha256sum. Paths always use forward slashes.
+// Args:
+//
+//	root(string): Folder path of the files to checksum.
+//	manifestPath(string): File path to write the manifest to, skipped if within root.
+//	algo(string): The hash algorithm to use, one of "md5", "sha1", or "sha256".
+//
+// Returns:
+//
+//	error: Any error from walking root, hashing files, or writing the manifest, else nil.
+func WriteChecksumManifest(root string, manifestPath string, algo string) error {
+	files, err := WalkDirContents(root, false, false)
+	if err != nil {
+		return err
+	}
+
+	manifestAbs, err := filepath.Abs(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, file := range files {
+		filePath := filepath.Join(root, file)
+		fileAbs, err := filepath.Abs(filePath)
+		if err != nil {
+			return err
+		}
+		if fileAbs == manifestAbs {
+			continue
+		}
+		info, err := os.Lstat(filePath)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		digest, err := HashFile(filePath, algo)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, digest+"  "+filepath.ToSlash(file))
+	}
+	return WriteLines(manifestPath, lines, true)
+}
+
+// Verifies the files beneath a directory against a manifest from WriteChecksumManifest.
+// The hash algorithm is detected from the length of each digest.
+// Args:
+//
+//	root(string): Folder path of the files to verify.
+//	manifestPath(string): File path of the manifest to verify against.
+//
+// Returns:
+//
+//	[]string: Relative paths of files that are missing or whose contents do not match.
+//	error: A custom error for a malformed manifest line, any error from reading the
+//	manifest or hashing files, else nil.
+func VerifyChecksumManifest(root string, manifestPath string) ([]string, error) {
+	lines, err := ReadLines(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	algos := map[int]string{32: "md5", 40: "sha1", 64: "sha256"}
+
+	var failed []string
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		digest, file, found := strings.Cut(line, "  ")
+		algo, known := algos[len(digest)]
+		if !found || !known {
+			errorMsg := fmt.Sprintf("malformed manifest line %d: %s", i+1, line)
+			return nil, errors.New(errorMsg)
+		}
+
+		filePath := filepath.Join(root, filepath.FromSlash(file))
+		exists, err := FileExists(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			failed = append(failed, file)
+			continue
+		}
+
+		actual, err := HashFile(filePath, algo)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(actual, digest) {
+			failed = append(failed, file)
+		}
+	}
+	return failed, nil
+}
+
+// Finds paths matching a glob pattern, keeping only those within the safety path.
+// Args:
+//
+//	pattern(string): Glob pattern, in the syntax of filepath.Glob.
+//
+// Returns:
+//
+//	[]string: The matching paths within the safety path, empty if nothing matches.
+//	error: filepath.ErrBadPattern for a malformed pattern, any error from checking
+//	the safety path, else nil.
+func GlobSafe(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	safeMatches := make([]string, 0, len(matches))
+	for _, match := range matches {
+		_, inSafetyPath, err := withinSafetyPath(match)
+		if err != nil {
+			return nil, err
+		}
+		if inSafetyPath {
+			safeMatches = append(safeMatches, match)
+		}
+	}
+	return safeMatches, nil
+}
+
+// Runs a function while holding an exclusive OS-level advisory lock, serializing
+// access to a file across goroutines and processes. The lock is held on a sidecar
+// "<path>.lock" file, which is left in place afterwards, so the target can still be
+// replaced atomically, such as by ExportMapToJson.
+// Args:
+//
+//	path(string): The file path to lock.
+//	fn(func() error): The function to run while the lock is held.
+//
+// Returns:
+//
+//	error: Any error from acquiring or releasing the lock, or the error returned by fn.
+func WithFileLock(path string, fn func() error) error {
+	file, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = lockFile(file)
+	if err != nil {
+		return err
+	}
+
+	fnErr := fn()
+	err = unlockFile(file)
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
+// Copies a file alongside itself with a ".YYYYMMDD-HHMMSS.bak" suffix.
+// Args:
+//
+//	path(string): The file path of the file to back up.
+//
+// Returns:
+//
+//	string: The file path of the created backup.
+//	error: A *PathError wrapping fs.ErrNotExist if the file does not exist, ErrDestExists
+//	if a backup was already made this second, any other error from CopyFileOverWrite, else nil.
+func BackupFile(path string) (string, error) {
+	backupPath := fmt.Sprintf("%s.%s.bak", path, clock().Format("20060102-150405"))
+
+	err := CopyFileOverWrite(path, backupPath, false)
+	if err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
+
+// Counts the lines in a text file, including a final line without a trailing newline.
+// Args:
+//
+//	path(string): The file path of the text file to count.
+//
+// Returns:
+//
+//	int: The number of lines, 0 for an empty file.
+//	error: Any error from opening or reading the file, else nil.
+func CountLines(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count := 0
+	var last byte = '\n'
+	reader := bufio.NewReader(file)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			count += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if last != '\n' {
+		count++
+	}
+	return count, nil
+}
+
+// Gets the size of a file in bytes.
+// Args:
+//
+//	path(string): The file path of the file to measure.
+//
+// Returns:
+//
+//	int64: The size of the file in bytes.
+//	error: Any *PathError from os.Stat, else nil.
+func CountBytes(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// The interval WatchDir polls a directory at.
+const defaultWatchInterval = time.Second
+
+// Watches a directory tree by polling it once a second, sending the full path of every
+// file that is created, modified, or deleted until the context is cancelled.
+// Args:
+//
+//	ctx(context.Context): Stops the watch when cancelled.
+//	path(string): Folder path of the directory to watch.
+//	events(chan<- string): Receives the full path of each changed file.
+//
+// Returns:
+//
+//	error: ctx.Err() once the context is cancelled, any error from scanning the
+//	directory, else nil.
+func WatchDir(ctx context.Context, path string, events chan<- string) error {
+	return WatchDirInterval(ctx, path, defaultWatchInterval, events)
+}
+
+// Watches a directory tree by polling it at the given interval, sending the full path
+// of every file that is created, modified, or deleted until the context is cancelled.
+// Args:
+//
+//	ctx(context.Context): Stops the watch when cancelled.
+//	path(string): Folder path of the directory to watch.
+//	interval(time.Duration): How long to wait between each scan of the directory, values
+//	below 1 use the one second default of WatchDir.
+//	events(chan<- string): Receives the full path of each changed file.
+//
+// Returns:
+//
+//	error: ctx.Err() once the context is cancelled, any error from scanning the
+//	directory, else nil.
+func WatchDirInterval(ctx context.Context, path string, interval time.Duration, events chan<- string) error {
+	previous, err := scanFileStates(path)
+	if err != nil {
+		return err
+	}
+
+	if interval < 1 {
+		interval = defaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		current, err := scanFileStates(path)
+		if err != nil {
+			return err
+		}
+
+		var changed []string
+		for file, state := range current {
+			old, found := previous[file]
+			if !found || old.size != state.size || !old.modTime.Equal(state.modTime) {
+				changed = append(changed, file)
+			}
+		}
+		for file := range previous {
+			_, found := current[file]
+			if !found {
+				changed = append(changed, file)
+			}
+		}
+		sort.Strings(changed)
+
+		for _, file := range changed {
+			select {
+			case events <- file:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		previous = current
+	}
+}
+
+// The size and modification time of a file, used to detect changes between scans.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Helper function that records the state of every file beneath a directory.
+// Args:
+//
+//	path(string): Folder path of the directory to scan.
+//
+// Returns:
+//
+//	map[string]fileState: The state of each file keyed by its full path.
+//	error: Any error created from walking the directory tree, else nil.
+func scanFileStates(path string) (map[string]fileState, error) {
+	states := make(map[string]fileState)
+	err := filepath.WalkDir(path, func(itemPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed since the directory was read, picked up as deleted next scan.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		states[itemPath] = fileState{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// A log file that rolls over to a new "<yyyymmdd>.log" file, named from today's date,
+// whenever the date changes between writes. Safe for use by multiple goroutines.
+type DatedLogWriter struct {
+	mu     sync.Mutex
+	dir    string
+	date   string
+	file   *os.File
+	closed bool
+}
+
+// Opens, creating if needed, a "<yyyymmdd>.log" file named from today's date in append mode.
+// The returned writer can be kept across days, each write checks the date and closes the
+// previous day's file and opens a new one when it has changed.
+// Args:
+//
+//	dir(string): Folder path to place the log files in.
+//
+// Returns:
+//
+//	*DatedLogWriter: The open writer, which must be closed with Close.
+//	error: Any error from resolving dir or opening the file, else nil.
+func OpenDatedLog(dir string) (*DatedLogWriter, error) {
+	dirAbs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &DatedLogWriter{dir: dirAbs}
+	err = writer.rotate()
+	if err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// Writes to the log file for today's date, rolling over to a new file if the date changed.
+// Args:
+//
+//	p([]byte): The bytes to append to the log.
+//
+// Returns:
+//
+//	int: The number of bytes written.
+//	error: os.ErrClosed if the writer was closed, any error from opening or writing the
+//	file, else nil.
+func (w *DatedLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	err := w.rotate()
+	if err != nil {
+		return 0, err
+	}
+	return w.file.Write(p)
+}
+
+// Closes the current log file.
+// Returns:
+//
+//	error: Any error from closing the file, else nil.
+func (w *DatedLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.file.Close()
+}
+
+// Helper function that opens the log file for today's date if it is not already open,
+// closing the previous day's file.
+// Returns:
+//
+//	error: Any error from opening the file, else nil.
+func (w *DatedLogWriter) rotate() error {
+	date := GetDate()
+	if w.file != nil && w.date == date {
+		return nil
+	}
+
+	file, err := os.OpenFile(filepath.Join(w.dir, date+".log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.date = date
+	w.file = file
+	return nil
+}
+
+// Finds paths beneath a directory that differ only by case, which would overwrite
+// each other when copied to a case-insensitive filesystem.
+// Args:
+//
+//	root(string): Folder path to search beneath.
+//
+// Returns:
+//
+//	map[string][]string: Each group of colliding full paths keyed by their lowercased
+//	path relative to root. Only groups of two or more paths are included.
+//	error: Any error created from walking the directory tree, else nil.
+func FindCaseCollisions(root string) (map[string][]string, error) {
+	items, err := WalkDirContents(root, false, true)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]string)
+	for _, item := range items {
+		key := strings.ToLower(item)
+		groups[key] = append(groups[key], filepath.Join(root, item))
+	}
+
+	collisions := make(map[string][]string)
+	for key, paths := range groups {
+		if len(paths) > 1 {
+			collisions[key] = paths
+		}
+	}
+	return collisions, nil
+}
+
+// Finds files beneath a directory with identical contents. Files are grouped by size
+// first, and only files sharing a size are hashed with sha256. Symlinks are ignored.
+// Args:
+//
+//	root(string): Folder path to search beneath.
+//
+// Returns:
+//
+//	map[string][]string: Each group of duplicate full paths keyed by their sha256 hash.
+//	Only groups of two or more paths are included.
+//	error: Any error created from walking the directory tree or hashing files, else nil.
+func FindDuplicates(root string) (map[string][]string, error) {
+	files, err := WalkDirContents(root, true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[int64][]string)
+	for _, file := range files {
+		info, err := os.Lstat(file)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		sizes[info.Size()] = append(sizes[info.Size()], file)
+	}
+
+	groups := make(map[string][]string)
+	for _, paths := range sizes {
+		if len(paths) < 2 {
+			continue
+		}
+		for _, path := range paths {
+			sum, err := HashFile(path, "sha256")
+			if err != nil {
+				return nil, err
+			}
+			groups[sum] = append(groups[sum], path)
+		}
+	}
+
+	duplicates := make(map[string][]string)
+	for sum, paths := range groups {
+		if len(paths) > 1 {
+			duplicates[sum] = paths
+		}
+	}
+	return duplicates, nil
+}
+
+// Gets the full path of the most recently modified file in a directory, ignoring subdirectories.
+// Args:
+//
+//	dir(string): Directory path to search.
+//
+// Returns:
+//
+//	string: Full path of the newest file.
+//	error: ErrNoFiles if the directory has no files, any error from reading the directory, else nil.
+func NewestFile(dir string) (string, error) {
+	return firstFileBy(dir, SortModTimeDesc)
+}
+
+// Gets the full path of the least recently modified file in a directory, ignoring subdirectories.
+// Args:
+//
+//	dir(string): Directory path to search.
+//
+// Returns:
+//
+//	string: Full path of the oldest file.
+//	error: ErrNoFiles if the directory has no files, any error from reading the directory, else nil.
+func OldestFile(dir string) (string, error) {
+	return firstFileBy(dir, SortModTimeAsc)
+}
+
+// Helper function that gets the first file in a directory for a sort order.
+// Args:
+//
+//	dir(string): Directory path to search.
+//	order(SortOrder): The order to sort the files by.
+//
+// Returns:
+//
+//	string: Full path of the first file.
+//	error: ErrNoFiles if the directory has no files, any error from reading the directory, else nil.
+func firstFileBy(dir string, order SortOrder) (string, error) {
+	files, err := GetDirContentsFiltered(dir, true, ListOptions{FilesOnly: true, Sort: order})
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrNoFiles, dir)
+	}
+	return files[0], nil
+}
+
+// Changes the permissions of every file and directory beneath and including root.
+// Individual failures do not stop the walk. Directories are changed after their
+// contents so restrictive directory modes do not block the walk, symlinks are skipped.
+// Args:
+//
+//	root(string): Folder path of the tree to change.
+//	fileMode(os.FileMode): The permissions to apply to files.
+//	dirMode(os.FileMode): The permissions to apply to directories.
+//
+// Returns:
+//
+//	error: The first error encountered while walking or changing permissions, else nil.
+func ChmodRecursive(root string, fileMode os.FileMode, dirMode os.FileMode) error {
+	var firstErr error
+	var dirs []string
+
+	walkErr := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return nil
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+
+		err = os.Chmod(path, fileMode)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return nil
+	})
+	if walkErr != nil && firstErr == nil {
+		firstErr = walkErr
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err := os.Chmod(dirs[i], dirMode)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Removes every directory beneath root that is empty, or becomes empty once its empty
+// subdirectories are removed, as long as root is within the safety path. Root itself is kept.
+// Args:
+//
+//	root(string): Folder path of the tree to prune.
+//
+// Returns:
+//
+//	[]string: Full paths of the removed directories, deepest first.
+//	error: ErrOutsideSafetyPath if root was not within the safety path, any error from
+//	walking the tree or removing a directory, else nil.
+func PruneEmptyDirs(root string) (removed []string, err error) {
+	defer func() { logOperation("PruneEmptyDirs", root, err) }()
+
+	target, inSafetyPath, err := withinSafetyPath(root)
+	if err != nil {
+		return nil, err
+	}
+	if !inSafetyPath {
+		return nil, fmt.Errorf("%w: folder path %s is not within %s", ErrOutsideSafetyPath, root, safetyPath)
+	}
+
+	var dirs []string
+	err = filepath.WalkDir(target, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != target {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// WalkDir visits parents before children, so in reverse every child comes first.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		empty, err := IsDirEmpty(dirs[i])
+		if err != nil {
+			return nil, err
+		}
+		if !empty {
+			continue
+		}
+		err = os.Remove(dirs[i])
+		if err != nil {
+			return nil, err
+		}
+		removed = append(removed, dirs[i])
+	}
+	return removed, nil
+}
+
+// Writes values to a JSON Lines file, one json encoded value per line, keeping the
+// file open between writes. Safe for use by multiple goroutines.
+type JSONLinesWriter struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// Opens a JSON Lines file for writing, creating it if it does not exist.
+// Args:
+//
+//	path(string): The file path of the .jsonl file.
+//	append(bool): To append to an existing file, else any existing file is truncated.
+//
+// Returns:
+//
+//	*JSONLinesWriter: The open writer, which must be closed with Close.
+//	error: Any *PathError from opening the file, else nil.
+func NewJSONLinesWriter(path string, append bool) (*JSONLinesWriter, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if append {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesWriter{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// Encodes a value as json and writes it as a single line.
+// Args:
+//
+//	v(interface{}): Any value that can be encoded by encoding/json.
+//
+// Returns:
+//
+//	error: Any error from encoding or writing the value, else nil.
+func (w *JSONLinesWriter) Write(v interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.encoder.Encode(v)
+}
+
+// Closes the underlying file.
+// Returns:
+//
+//	error: Any error from closing the file, else nil.
+func (w *JSONLinesWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+// Compares two text files line by line, treating "\r\n" and "\n" line endings as equal.
+// Args:
+//
+//	a(string): File path of the first text file.
+//	b(string): File path of the second text file.
+//
+// Returns:
+//
+//	bool: True if both files have the same lines else false.
+//	error: Any error from opening or scanning either file, else nil.
+func FilesEqualText(a string, b string) (bool, error) {
+	aFile, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer aFile.Close()
+
+	bFile, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer bFile.Close()
+
+	aScanner := bufio.NewScanner(aFile)
+	bScanner := bufio.NewScanner(bFile)
+	for {
+		aMore := aScanner.Scan()
+		bMore := bScanner.Scan()
+		if !aMore || !bMore {
+			err := aScanner.Err()
+			if err != nil {
+				return false, err
+			}
+			err = bScanner.Err()
+			if err != nil {
+				return false, err
+			}
+			return aMore == bMore, nil
+		}
+		if aScanner.Text() != bScanner.Text() {
+			return false, nil
+		}
+	}
+}
+
+// Writes a file, creating any missing parent directories first.
+// Args:
+//
+//	path(string): The file path to write.
+//	data([]byte): The contents of the file.
+//
+// Returns:
+//
+//	error: Any error from creating the parent directories or writing the file, else nil.
+func CreateFileAll(path string, data []byte) error {
+	err := CreateDirectoryAll(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(path, data, 0666)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Joins path parts onto a base directory, refusing any result that escapes the base.
+// Args:
+//
+//	base(string): The directory the joined path must stay within.
+//	parts(...string): The path elements to join onto base.
+//
+// Returns:
+//
+//	string: The joined and cleaned path.
+//	error: ErrPathEscapes if the joined path is outside of base, such as through "..",
+//	any error from resolving the paths, else nil.
+func JoinSafe(base string, parts ...string) (string, error) {
+	joined := filepath.Join(append([]string{base}, parts...)...)
+	inBase, err := isWithin(base, joined)
+	if err != nil {
+		return "", err
+	}
+	if !inBase {
+		return "", fmt.Errorf("%w: %s is not within %s", ErrPathEscapes, joined, base)
+	}
+	return joined, nil
+}
+
+// Reads up to the first n bytes of a file without loading the rest of it.
+// Args:
+//
+//	path(string): The file path of the file to read.
+//	n(int): The maximum number of bytes to read.
+//
+// Returns:
+//
+//	[]byte: The first n bytes, or the whole file if it is shorter than n.
+//	error: Any error from opening or reading the file, else nil.
+func PeekFile(path string, n int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if n < 0 {
+		n = 0
+	}
+	// The buffer grows as data is read, so a large n never allocates more than the file holds.
+	data, err := io.ReadAll(io.LimitReader(file, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Detects the MIME type of a file from its first 512 bytes, without trusting its extension.
+// Args:
+//
+//	path(string): The file path of the file to inspect.
+//
+// Returns:
+//
+//	string: The MIME type from http.DetectContentType, "text/plain; charset=utf-8" for an
+//	empty file and "application/octet-stream" when nothing more specific matches.
+//	error: Any error from reading the file, else nil.
+func DetectContentType(path string) (string, error) {
+	sniff, err := PeekFile(path, 512)
+	if err != nil {
+		return "", err
+	}
+	return http.DetectContentType(sniff), nil
+}
+
+// Writes the new contents for WriteFileWithBackup, replaceable so tests can simulate a
+// failed write.
+var writeFile = os.WriteFile
+
+// Writes a file after first copying any existing file to "<path>.bak". If writing the
+// new contents fails the original file is restored from the backup.
+// Args:
+//
+//	path(string): The file path to write.
+//	data([]byte): The new contents of the file.
+//
+// Returns:
+//
+//	error: Any error from creating the backup or writing the file, joined with any
+//	error from restoring the backup, else nil.
+func WriteFileWithBackup(path string, data []byte) (err error) {
+	defer func() { logOperation("WriteFileWithBackup", path, err) }()
+
+	exists, err := FileExists(path)
+	if err != nil {
+		return err
+	}
+
+	backupPath := path + ".bak"
+	if exists {
+		err := CopyFile(path, backupPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writeFile(path, data, 0666)
+	if err != nil {
+		if exists {
+			restoreErr := CopyFile(backupPath, path)
+			if restoreErr != nil {
+				return errors.Join(err, restoreErr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// Creates a symlink at linkPath pointing to target.
+// Args:
+//
+//	target(string): The path the symlink points to, does not need to exist.
+//	linkPath(string): The path of the symlink to create.
+//
+// Returns:
+//
+//	error: A *LinkError from os.Symlink, else nil.
+func CreateSymlink(target string, linkPath string) error {
+	err := os.Symlink(target, linkPath)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Reads the target of a symlink without resolving it further.
+// Args:
+//
+//	linkPath(string): The path of the symlink to read.
+//
+// Returns:
+//
+//	string: The target the symlink points to.
+//	error: A *PathError from os.Readlink, such as when the path is not a symlink, else nil.
+func ReadSymlink(linkPath string) (string, error) {
+	return os.Readlink(linkPath)
+}
+
+// Determines if a path is a symlink, without following it.
+// Args:
+//
+//	path(string): The path to check.
+//
+// Returns:
+//
+//	bool: True if the path is a symlink else false.
+//	error: Any *PathError from os.Lstat, including when the path does not exist, else nil.
+func IsSymlink(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	return info.Mode()&os.ModeSymlink != 0, nil
+}
+
+// Copies every file beneath source into the single dest directory, naming each copy
+// from its relative path joined with separator, such as "sub_dir_file.txt".
+// Args:
+//
+//	source(string): Folder path of the tree to flatten.
+//	dest(string): Folder path to copy the flattened files into.
+//	separator(string): Replaces the path separators in each relative path.
+//
+// Returns:
+//
+//	error: ErrDestExists naming the colliding files if two would share a flattened name,
+//	checked before anything is copied, any error from walking or copying, else nil.
+func FlattenDirectory(source string, dest string, separator string) error {
+	files, err := WalkDirContents(source, false, false)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]string, len(files))
+	for _, file := range files {
+		name := strings.ReplaceAll(filepath.ToSlash(file), "/", separator)
+		other, found := names[name]
+		if found {
+			return fmt.Errorf("%w: %s and %s both flatten to %s", ErrDestExists, other, file, name)
+		}
+		names[name] = file
+	}
+
+	err = CreateDirectoryAll(dest)
+	if err != nil {
+		return err
+	}
+	for name, file := range names {
+		err := CopyFile(filepath.Join(source, file), filepath.Join(dest, name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copies the files in a directory tree modified after a point in time into a destination,
+// keeping their paths relative to the source and creating directories as needed.
+// Only regular files are copied, newer files already in the destination are overwritten.
+// Args:
+//
+//	source(string): Folder path to copy changed files from.
+//	dest(string): Folder path to copy changed files into.
+//	since(time.Time): Only files with a modification time after this are copied.
+//
+// Returns:
+//
+//	[]string: Paths of the copied files relative to source, nil on error.
+//	error: Any error created from walking the source or copying files, else nil.
+func CopyNewerThan(source string, dest string, since time.Time) ([]string, error) {
+	files, err := WalkDirContents(source, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var copied []string
+	for _, file := range files {
+		sourcePath := filepath.Join(source, file)
+		info, err := os.Lstat(sourcePath)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() || !info.ModTime().After(since) {
+			continue
+		}
+
+		destPath := filepath.Join(dest, file)
+		err = CreateDirectoryAll(filepath.Dir(destPath))
+		if err != nil {
+			return nil, err
+		}
+		err = CopyFile(sourcePath, destPath)
+		if err != nil {
+			return nil, err
+		}
+		copied = append(copied, file)
+	}
+	return copied, nil
+}
+
+// Runs a function until it succeeds, returns an error that is not transient, or the
+// attempts run out. Transient errors are those such as a file being used by another
+// process on Windows, or a busy resource on Unix.
+// Args:
+//
+//	attempts(int): The maximum number of times to run fn, values below 1 run it once.
+//	delay(time.Duration): How long to wait between attempts.
+//	fn(func() error): The function to run.
+//
+// Returns:
+//
+//	error: The last error returned by fn, else nil.
+func WithRetry(attempts int, delay time.Duration, fn func() error) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+		}
+		err = fn()
+		if err == nil || !isRetryableError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// Sets how DeleteSafeFile and DeleteSafeDirectory retry deletes that fail with
+// transient errors, see WithRetry. The default is a single attempt with no retries.
+// Args:
+//
+//	attempts(int): The maximum number of delete attempts, values below 1 are treated as 1.
+//	delay(time.Duration): How long to wait between attempts.
+func SetDeleteRetry(attempts int, delay time.Duration) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	deleteRetryAttempts = attempts
+	deleteRetryDelay = delay
+}
+
+// Sets whether DeleteSafeFile and DeleteSafeDirectory clear the read-only state of
+// files that fail to delete with a permission error and then retry the delete. This
+// is off by default, on Windows os.Remove cannot delete read-only files without it.
+// Args:
+//
+//	enabled(bool): To make read-only files writable and retry failed deletes.
+func SetDeleteReadOnly(enabled bool) {
+	deleteReadOnly = enabled
+}
+
+// Helper function that removes a file, making it writable and trying again if the
+// removal fails with a permission error and SetDeleteReadOnly is enabled.
+// Args:
+//
+//	path(string): The path to the file to remove.
+//
+// Returns:
+//
+//	error: Any error from removing the file or changing its permissions, else nil.
+func removeFile(path string) error {
+	err := os.Remove(path)
+	if err == nil || !deleteReadOnly || !errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+
+	err = makeWritable(path)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Helper function that removes a path and its contents, making every entry writable
+// and trying again if the removal fails with a permission error and SetDeleteReadOnly
+// is enabled.
+// Args:
+//
+//	path(string): The path to remove.
+//
+// Returns:
+//
+//	error: Any error from removing the path or changing permissions, else nil.
+func removeAll(path string) error {
+	err := os.RemoveAll(path)
+	if err == nil || !deleteReadOnly || !errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+
+	err = filepath.WalkDir(path, func(entry string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		return makeWritable(entry)
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+// Helper function that adds owner write permission to a path, which also clears the
+// read-only attribute on Windows.
+// Args:
+//
+//	path(string): The path to make writable.
+//
+// Returns:
+//
+//	error: Any error from reading or changing the path's permissions, else nil.
+func makeWritable(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(path, info.Mode().Perm()|0200)
+}
+
+// The hash function CopyFileVerified compares files with, replaceable so tests can
+// force a checksum mismatch.
+var verifyHash = HashFile
+
+// Copy file into a separate destination folder, then verify the copy by comparing
+// the sha256 hashes of both files. A copy that does not match is deleted.
+// Args:
+//
+//	source(string): File path of the file to copy.
+//	dest(string): File path to copy the file too, optionally can have different name.
+//
+// Returns:
+//
+//	error: ErrChecksumMismatch if the copy does not match the source, any error from
+//	copying or hashing either file, else nil.
+func CopyFileVerified(source string, dest string) (err error) {
+	defer func() { logOperation("CopyFileVerified", source, err) }()
+
+	err = CopyFile(source, dest)
+	if err != nil {
+		return err
+	}
+
+	sourceHash, err := verifyHash(source, "sha256")
+	if err != nil {
+		return err
+	}
+	destHash, err := verifyHash(dest, "sha256")
+	if err != nil {
+		return err
+	}
+
+	if sourceHash != destHash {
+		os.Remove(dest)
+		return fmt.Errorf("%w: %s does not match %s", ErrChecksumMismatch, dest, source)
+	}
+	return nil
+}
+
+// The size and modification time of a file recorded by TakeSnapshot.
+type SnapshotEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// A record of every file in a directory tree at a point in time, serializable with
+// ExportStructToJson so it can be compared later with DiffSnapshots.
+type Snapshot struct {
+	Root  string                   `json:"root"`
+	Files map[string]SnapshotEntry `json:"files"`
+}
+
+// Records the relative path, size, and modification time of every file beneath a directory.
+// Named TakeSnapshot as the Snapshot name is used by the type it returns.
+// Args:
+//
+//	root(string): Folder path of the tree to record.
+//
+// Returns:
+//
+//	Snapshot: The recorded files keyed by their forward slash path relative to root.
+//	error: Any error created from walking the directory tree, else nil.
+func TakeSnapshot(root string) (Snapshot, error) {
+	snapshot := Snapshot{Root: root, Files: make(map[string]SnapshotEntry)}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		snapshot.Files[filepath.ToSlash(rel)] = SnapshotEntry{Size: info.Size(), ModTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// Compares two snapshots of the same tree, a file is modified when its size or
+// modification time changed.
+// Args:
+//
+//	oldSnap(Snapshot): The earlier snapshot.
+//	newSnap(Snapshot): The later snapshot.
+//
+// Returns:
+//
+//	added([]string): Sorted relative paths only in the new snapshot.
+//	removed([]string): Sorted relative paths only in the old snapshot.
+//	modified([]string): Sorted relative paths in both snapshots that changed.
+func DiffSnapshots(oldSnap Snapshot, newSnap Snapshot) (added, removed, modified []string) {
+	for file, newEntry := range newSnap.Files {
+		oldEntry, found := oldSnap.Files[file]
+		if !found {
+			added = append(added, file)
+			continue
+		}
+		if oldEntry.Size != newEntry.Size || !oldEntry.ModTime.Equal(newEntry.ModTime) {
+			modified = append(modified, file)
+		}
+	}
+	for file := range oldSnap.Files {
+		_, found := newSnap.Files[file]
+		if !found {
+			removed = append(removed, file)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(modified)
+	return added, removed, modified
+}
+
+// Computes how many directory levels a target path is below a base path.
+// Args:
+//
+//	base(string): The path to measure from.
+//	target(string): The path to measure to.
+//
+// Returns:
+//
+//	int: The number of levels target is below base, 0 when they are the same path and
+//	negative when target is a parent of base, such as -1 for the direct parent.
+//	error: A custom error when target is neither beneath nor a parent of base, such as
+//	a sibling directory, any error from resolving the paths, else nil.
+func PathDepth(base string, target string) (int, error) {
+	baseAbs, err := filepath.Abs(NormalizePath(base))
+	if err != nil {
+		return 0, err
+	}
+	targetAbs, err := filepath.Abs(NormalizePath(target))
+	if err != nil {
+		return 0, err
+	}
+
+	rel, err := filepath.Rel(baseAbs, targetAbs)
+	if err != nil {
+		return 0, err
+	}
+	if rel == "." {
+		return 0, nil
+	}
+
+	parts := strings.Split(rel, string(os.PathSeparator))
+	ups := 0
+	for _, part := range parts {
+		if part == ".." {
+			ups++
+		}
+	}
+	if ups == 0 {
+		return len(parts), nil
+	}
+	if ups == len(parts) {
+		return -ups, nil
+	}
+	errorMsg := fmt.Sprintf("%s is not beneath or a parent of %s", target, base)
+	return 0, errors.New(errorMsg)
+}
+
+// Finds the deepest directory that contains every given path. Paths that are not
+// existing directories are treated as files, so a single file returns its parent.
+// Args:
+//
+//	paths([]string): The file and directory paths to find the common parent of.
+//
+// Returns:
+//
+//	string: The absolute path of the deepest common directory.
+//	error: A custom error if paths is empty or the paths share no common directory,
+//	such as paths on different Windows drives, any error from resolving the paths, else nil.
+func CommonParent(paths []string) (string, error) {
+	if len(paths) == 0 {
+		return "", errors.New("no paths given")
+	}
+
+	dirs := make([]string, len(paths))
+	for i, path := range paths {
+		absPath, err := filepath.Abs(NormalizePath(path))
+		if err != nil {
+			return "", err
+		}
+		isDirectory, err := DirExists(absPath)
+		if err != nil {
+			return "", err
+		}
+		if !isDirectory {
+			absPath = filepath.Dir(absPath)
+		}
+		dirs[i] = absPath
+	}
+
+	parent := dirs[0]
+	for i, dir := range dirs[1:] {
+		for !containsPath(parent, dir) {
+			next := filepath.Dir(parent)
+			if next == parent {
+				errorMsg := fmt.Sprintf("%s and %s have no common parent", paths[0], paths[i+1])
+				return "", errors.New(errorMsg)
+			}
+			parent = next
+		}
+	}
+	return parent, nil
+}
+
+// Opens a file for writing, creating any missing parent directories first. The caller
+// is responsible for closing the returned file.
+// Args:
+//
+//	path(string): The file path to open.
+//	overWrite(bool): To truncate the file if it already exists in path.
+//
+// Returns:
+//
+//	*os.File: The file opened for writing.
+//	error: ErrDestExists if overWrite is false and the file exists, any error from
+//	creating the parent directories or opening the file, else nil.
+func OpenForWrite(path string, overWrite bool) (*os.File, error) {
+	err := CreateDirectoryAll(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	return openFileForWrite(path, overWrite)
+}
+
+// Helper function that opens a file for writing, truncating or refusing an existing file.
+// Args:
+//
+//	path(string): The file path to open.
+//	overWrite(bool): To truncate the file if it already exists in path.
+//
+// Returns:
+//
+//	*os.File: The file opened for writing.
+//	error: ErrDestExists if overWrite is false and the file exists, any *PathError
+//	from os.OpenFile, else nil.
+func openFileForWrite(path string, overWrite bool) (*os.File, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overWrite {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	file, err := os.OpenFile(path, flag, 0666)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("%w: %s", ErrDestExists, path)
+		}
+		return nil, err
+	}
+	return file, nil
 }
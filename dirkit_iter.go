@@ -0,0 +1,34 @@
+//go:build go1.23
+
+package dirkit
+
+import (
+	"io/fs"
+	"iter"
+	"path/filepath"
+)
+
+// Recursively walks a directory tree for use with range, yielding the full path of
+// every file and directory beneath root. Errors are yielded alongside the path they
+// occurred at and the walk continues, breaking out of the range stops the walk.
+// Args:
+//
+//	root(string): Directory path to walk.
+//
+// Returns:
+//
+//	iter.Seq2[string, error]: Yields each full path and any error from reaching it.
+func WalkSeq(root string) iter.Seq2[string, error] {
+	root = filepath.Clean(root)
+	return func(yield func(string, error) bool) {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && path == root {
+				return nil
+			}
+			if !yield(path, err) {
+				return filepath.SkipAll
+			}
+			return nil
+		})
+	}
+}
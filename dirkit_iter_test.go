@@ -0,0 +1,79 @@
+//go:build go1.23
+
+package dirkit
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestWalkSeq(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir, "sub", "b.txt"), "b")
+
+	var got []string
+	for path, err := range WalkSeq(dir) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, path)
+	}
+	assertSameItems(t, got, []string{
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "sub"),
+		filepath.Join(dir, "sub", "b.txt"),
+	})
+}
+
+func TestWalkSeqStopsEarly(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		writeTestFile(t, filepath.Join(dir, name), name)
+	}
+
+	// Calling yield again after it returned false would mean the walk kept going.
+	calls := 0
+	WalkSeq(dir)(func(path string, err error) bool {
+		calls++
+		return false
+	})
+	if calls != 1 {
+		t.Fatalf("yield was called %d times after asking to stop, want 1", calls)
+	}
+
+	count := 0
+	for range WalkSeq(dir) {
+		count++
+		break
+	}
+	if count != 1 {
+		t.Fatalf("range ran %d times, want 1", count)
+	}
+}
+
+func TestWalkSeqConcurrentRanges(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "sub", "a.txt"), "a")
+	seq := WalkSeq(dir)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count := 0
+			for _, err := range seq {
+				if err != nil {
+					t.Error(err)
+				}
+				count++
+			}
+			if count != 2 {
+				t.Errorf("got %d paths, want 2", count)
+			}
+		}()
+	}
+	wg.Wait()
+}
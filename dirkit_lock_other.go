@@ -0,0 +1,21 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package dirkit
+
+import (
+	"errors"
+	"os"
+)
+
+// Returned by WithFileLock on platforms without OS-level file locking.
+var errLockUnsupported = errors.New("file locking is not supported on this platform")
+
+// Helper function that reports file locking is unsupported on this platform.
+func lockFile(file *os.File) error {
+	return errLockUnsupported
+}
+
+// Helper function that reports file locking is unsupported on this platform.
+func unlockFile(file *os.File) error {
+	return errLockUnsupported
+}
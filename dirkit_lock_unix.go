@@ -0,0 +1,32 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package dirkit
+
+import (
+	"os"
+	"syscall"
+)
+
+// Helper function that blocks until an exclusive advisory lock is held on the file.
+// Args:
+//
+//	file(*os.File): The open file to lock.
+//
+// Returns:
+//
+//	error: Any error from flock, else nil.
+func lockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
+
+// Helper function that releases a lock acquired by lockFile.
+// Args:
+//
+//	file(*os.File): The open file to unlock.
+//
+// Returns:
+//
+//	error: Any error from flock, else nil.
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,52 @@
+//go:build windows
+
+package dirkit
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+// LOCKFILE_EXCLUSIVE_LOCK, requests an exclusive rather than shared lock.
+const lockfileExclusiveLock = 0x2
+
+// Helper function that blocks until an exclusive lock is held on the file.
+// Args:
+//
+//	file(*os.File): The open file to lock.
+//
+// Returns:
+//
+//	error: Any error from LockFileEx, else nil.
+func lockFile(file *os.File) error {
+	overlapped := new(syscall.Overlapped)
+	r1, _, err := procLockFileEx.Call(file.Fd(), lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
+
+// Helper function that releases a lock acquired by lockFile.
+// Args:
+//
+//	file(*os.File): The open file to unlock.
+//
+// Returns:
+//
+//	error: Any error from UnlockFileEx, else nil.
+func unlockFile(file *os.File) error {
+	overlapped := new(syscall.Overlapped)
+	r1, _, err := procUnlockFileEx.Call(file.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+//go:build !unix && !windows
+
+package dirkit
+
+import "io/fs"
+
+// The line ending written by functions such as WriteLines.
+const lineEnding = "\n"
+
+// Helper function for determining if an error came from moving across devices.
+// Platforms such as plan9 and wasm have no cross-device error to check for.
+// Args:
+//
+//	err(error): The error returned from os.Rename.
+//
+// Returns:
+//
+//	bool: Always false.
+func isCrossDeviceError(err error) bool {
+	return false
+}
+
+// Helper function for determining if a file has an OS hidden attribute. Hidden files
+// on these platforms are only marked by a leading dot.
+// Args:
+//
+//	info(fs.FileInfo): The info of the file to check.
+//
+// Returns:
+//
+//	bool: Always false.
+func hasHiddenAttribute(info fs.FileInfo) bool {
+	return false
+}
+
+// Helper function for determining if an error is transient and worth retrying.
+// No errors are treated as transient on these platforms.
+// Args:
+//
+//	err(error): The error to check.
+//
+// Returns:
+//
+//	bool: Always false.
+func isRetryableError(err error) bool {
+	return false
+}
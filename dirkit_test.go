@@ -0,0 +1,3951 @@
+package dirkit
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Writes a file, creating any missing parent directories, failing the test on error.
+func writeTestFile(t *testing.T, path string, data string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Reads a file as a string, failing the test on error.
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Fails the test if the sorted values are not equal to the sorted expected values.
+func assertSameItems(t *testing.T, got []string, want []string) {
+	t.Helper()
+	got = append([]string(nil), got...)
+	want = append([]string(nil), want...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestGetDirContentsFullPath(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir, "b.txt"), "b")
+	want := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")}
+
+	for _, path := range []string{dir, dir + string(os.PathSeparator)} {
+		contents, err := GetDirContents(path, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSameItems(t, contents, want)
+	}
+}
+
+func TestGetDirContentsNames(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+	err := os.Mkdir(filepath.Join(dir, "sub"), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := GetDirContents(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, contents, []string{"a.txt", "sub"})
+}
+
+// Points the safety path at a new temp directory, restoring the previous safety path
+// when the test ends. The returned directory has its symlinks resolved.
+func useSafetyPath(t *testing.T) string {
+	t.Helper()
+	dir, err := ResolveAbs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := GetSafetyPath()
+	t.Cleanup(func() { safetyPath = previous })
+
+	err = SetSafetyPath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSetSafetyPath(t *testing.T) {
+	dir := useSafetyPath(t)
+	if GetSafetyPath() != dir+string(filepath.Separator) {
+		t.Fatalf("safety path is %s, want %s", GetSafetyPath(), dir+string(filepath.Separator))
+	}
+
+	err := SetSafetyPath("  ")
+	if err == nil {
+		t.Fatal("expected an error for an empty safety path")
+	}
+}
+
+func TestSetSafetyPathRestrictsDeletes(t *testing.T) {
+	dir := useSafetyPath(t)
+	outside := t.TempDir()
+	outsideFile := filepath.Join(outside, "keep.txt")
+	writeTestFile(t, outsideFile, "keep")
+
+	err := DeleteSafeFile(outsideFile)
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("got %v, want ErrOutsideSafetyPath", err)
+	}
+	if readTestFile(t, outsideFile) != "keep" {
+		t.Fatal("file outside the safety path was modified")
+	}
+
+	insideFile := filepath.Join(dir, "remove.txt")
+	writeTestFile(t, insideFile, "remove")
+	err = DeleteSafeFile(insideFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err := FileExists(insideFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("file inside the safety path was not deleted")
+	}
+}
+
+func TestCreateDirectoryAll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a", "b", "c")
+
+	err := CreateDirectoryAll(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err := DirExists(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("nested directory was not created")
+	}
+
+	err = CreateDirectoryAll(path)
+	if err != nil {
+		t.Fatalf("creating an existing directory: %v", err)
+	}
+}
+
+func TestCreateDirectoryMissingParent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "child")
+
+	err := CreateDirectory(path)
+	if err == nil {
+		t.Fatal("expected an error when the parent does not exist")
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.txt")
+	dest := filepath.Join(dir, "dest.txt")
+	writeTestFile(t, source, "moved")
+
+	err := MoveFile(source, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, dest) != "moved" {
+		t.Fatal("destination does not have the source contents")
+	}
+	exists, err := FileExists(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("source still exists after the move")
+	}
+}
+
+func TestMoveFileMissingSource(t *testing.T) {
+	dir := t.TempDir()
+
+	err := MoveFile(filepath.Join(dir, "missing.txt"), filepath.Join(dir, "dest.txt"))
+	if err == nil {
+		t.Fatal("expected an error for a missing source")
+	}
+}
+
+func TestPathExists(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	writeTestFile(t, file, "data")
+
+	exists, err := pathExists(file)
+	if err != nil || !exists {
+		t.Fatalf("got %v, %v for an existing file", exists, err)
+	}
+
+	exists, err = pathExists(filepath.Join(dir, "missing"))
+	if err != nil || exists {
+		t.Fatalf("got %v, %v for a missing path", exists, err)
+	}
+}
+
+func TestPathExistsPermissionDenied(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("permission bits are not enforced for this user")
+	}
+	dir := t.TempDir()
+	locked := filepath.Join(dir, "locked")
+	writeTestFile(t, filepath.Join(locked, "file.txt"), "data")
+	err := os.Chmod(locked, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0777) })
+
+	exists, err := pathExists(filepath.Join(locked, "file.txt"))
+	if err == nil {
+		t.Fatal("expected a permission error")
+	}
+	if exists {
+		t.Fatal("path reported as existing on a permission error")
+	}
+}
+
+func TestWalkDirContents(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir, "sub", "b.txt"), "b")
+	writeTestFile(t, filepath.Join(dir, "sub", "deeper", "c.txt"), "c")
+
+	files, err := WalkDirContents(dir, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, files, []string{
+		"a.txt",
+		filepath.Join("sub", "b.txt"),
+		filepath.Join("sub", "deeper", "c.txt"),
+	})
+
+	all, err := WalkDirContents(dir, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, all, []string{
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "sub"),
+		filepath.Join(dir, "sub", "b.txt"),
+		filepath.Join(dir, "sub", "deeper"),
+		filepath.Join(dir, "sub", "deeper", "c.txt"),
+	})
+}
+
+func TestWalkDirContentsMissingRoot(t *testing.T) {
+	_, err := WalkDirContents(filepath.Join(t.TempDir(), "missing"), false, false)
+	if err == nil {
+		t.Fatal("expected an error for a missing root")
+	}
+}
+
+func TestCopyFileKeepsPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permission bits are not supported")
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "script.sh")
+	dest := filepath.Join(dir, "copy.sh")
+	writeTestFile(t, source, "#!/bin/sh\n")
+	err := os.Chmod(source, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CopyFile(source, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Fatalf("copy has mode %v, want %v", info.Mode().Perm(), os.FileMode(0755))
+	}
+	if readTestFile(t, dest) != "#!/bin/sh\n" {
+		t.Fatal("copy does not have the source contents")
+	}
+}
+
+func TestCopyFileOverWrite(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.txt")
+	dest := filepath.Join(dir, "dest.txt")
+	writeTestFile(t, source, "new")
+	writeTestFile(t, dest, "old")
+
+	err := CopyFileOverWrite(source, dest, false)
+	if !errors.Is(err, ErrDestExists) {
+		t.Fatalf("got %v, want ErrDestExists", err)
+	}
+	if readTestFile(t, dest) != "old" {
+		t.Fatal("destination was overwritten")
+	}
+
+	err = CopyFileOverWrite(source, dest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, dest) != "new" {
+		t.Fatal("destination was not overwritten")
+	}
+}
+
+func TestImportJsonToMapRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	data := map[string]interface{}{"name": "dirkit", "count": 3.0, "tags": []interface{}{"a", "b"}}
+
+	err := ExportMapToJson(path, data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportJsonToMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported["name"] != "dirkit" || imported["count"] != 3.0 {
+		t.Fatalf("got %v, want %v", imported, data)
+	}
+	tags, ok := imported["tags"].([]interface{})
+	if !ok || len(tags) != 2 || tags[0] != "a" || tags[1] != "b" {
+		t.Fatalf("got tags %v, want [a b]", imported["tags"])
+	}
+}
+
+func TestImportJsonToMapErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := ImportJsonToMap(filepath.Join(dir, "missing.json"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want fs.ErrNotExist", err)
+	}
+
+	malformed := filepath.Join(dir, "malformed.json")
+	writeTestFile(t, malformed, "{not json")
+	_, err = ImportJsonToMap(malformed)
+	if !errors.Is(err, ErrInvalidJson) {
+		t.Fatalf("got %v, want ErrInvalidJson", err)
+	}
+}
+
+type testConfig struct {
+	Name    string   `json:"name"`
+	Retries int      `json:"retries"`
+	Paths   []string `json:"paths"`
+}
+
+func TestExportStructToJsonRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := testConfig{Name: "dirkit", Retries: 2, Paths: []string{"a", "b"}}
+
+	err := ExportStructToJson(path, config, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportStructFromJson[testConfig](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Name != config.Name || imported.Retries != config.Retries || len(imported.Paths) != 2 {
+		t.Fatalf("got %+v, want %+v", imported, config)
+	}
+}
+
+func TestExportStructToJsonNoOverWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, path, `{"name":"old"}`)
+
+	err := ExportStructToJson(path, testConfig{Name: "new"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, path) != `{"name":"old"}` {
+		t.Fatal("existing file was overwritten")
+	}
+}
+
+func TestExportMapToJsonIndent(t *testing.T) {
+	dir := t.TempDir()
+	data := map[string]interface{}{"a": 1, "b": "two"}
+
+	indented := filepath.Join(dir, "indented.json")
+	err := ExportMapToJsonIndent(indented, data, false, "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"a\": 1,\n  \"b\": \"two\"\n}"
+	if readTestFile(t, indented) != want {
+		t.Fatalf("got %q, want %q", readTestFile(t, indented), want)
+	}
+
+	compact := filepath.Join(dir, "compact.json")
+	err = ExportMapToJson(compact, data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, compact) != `{"a":1,"b":"two"}` {
+		t.Fatalf("got %q, want compact json", readTestFile(t, compact))
+	}
+}
+
+func TestDeleteSafeDirectoryDryRun(t *testing.T) {
+	dir := useSafetyPath(t)
+	target := filepath.Join(dir, "target")
+	writeTestFile(t, filepath.Join(target, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(target, "sub", "b.txt"), "b")
+
+	paths, err := DeleteSafeDirectoryDryRun(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, paths, []string{
+		target,
+		filepath.Join(target, "a.txt"),
+		filepath.Join(target, "sub"),
+		filepath.Join(target, "sub", "b.txt"),
+	})
+
+	exists, err := FileExists(filepath.Join(target, "sub", "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("dry run deleted a file")
+	}
+}
+
+func TestDeleteSafeDirectoryDryRunOutside(t *testing.T) {
+	useSafetyPath(t)
+
+	_, err := DeleteSafeDirectoryDryRun(t.TempDir())
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("got %v, want ErrOutsideSafetyPath", err)
+	}
+}
+
+// Creates a symlink, skipping the test if the platform or user cannot create one.
+func symlinkOrSkip(t *testing.T, target string, linkPath string) {
+	t.Helper()
+	err := os.Symlink(target, linkPath)
+	if err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+}
+
+func TestWithinSafetyPathBoundaries(t *testing.T) {
+	dir := useSafetyPath(t)
+	sibling := dir + "-other"
+	t.Cleanup(func() { os.RemoveAll(sibling) })
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{dir, true},
+		{dir + string(filepath.Separator), true},
+		{filepath.Join(dir, "child"), true},
+		{dir + string(filepath.Separator) + filepath.Join("child", "..", "other"), true},
+		{dir + string(filepath.Separator) + "..", false},
+		{dir + string(filepath.Separator) + filepath.Join("child", "..", "..", "escape"), false},
+		{filepath.Dir(dir), false},
+		{sibling, false},
+		{filepath.Join(sibling, "x"), false},
+	}
+	for _, test := range tests {
+		_, inSafetyPath, err := withinSafetyPath(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inSafetyPath != test.want {
+			t.Errorf("withinSafetyPath(%q) = %v, want %v", test.path, inSafetyPath, test.want)
+		}
+	}
+}
+
+func TestDeleteSafeDirectoryTraversal(t *testing.T) {
+	dir := useSafetyPath(t)
+	victim := t.TempDir()
+	writeTestFile(t, filepath.Join(victim, "keep.txt"), "keep")
+
+	rel, err := filepath.Rel(dir, victim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DeleteSafeDirectory(dir + string(filepath.Separator) + rel)
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("got %v, want ErrOutsideSafetyPath", err)
+	}
+	if readTestFile(t, filepath.Join(victim, "keep.txt")) != "keep" {
+		t.Fatal("directory outside the safety path was modified")
+	}
+}
+
+func TestDeleteSafeSymlinkEscape(t *testing.T) {
+	dir := useSafetyPath(t)
+	outside := t.TempDir()
+	victim := filepath.Join(filepath.Dir(outside), "victim.txt")
+	writeTestFile(t, victim, "keep")
+	writeTestFile(t, filepath.Join(outside, "inner.txt"), "keep")
+	link := filepath.Join(dir, "link")
+	symlinkOrSkip(t, outside, link)
+
+	paths := []string{filepath.Join(link, "inner.txt")}
+	if runtime.GOOS != "windows" {
+		// Windows collapses ".." before following symlinks, so this stays in the safety path there.
+		paths = append(paths, link+string(filepath.Separator)+filepath.Join("..", "victim.txt"))
+	}
+	for _, path := range paths {
+		err := DeleteSafeFile(path)
+		if !errors.Is(err, ErrOutsideSafetyPath) {
+			t.Errorf("DeleteSafeFile(%q) = %v, want ErrOutsideSafetyPath", path, err)
+		}
+	}
+	err := DeleteSafeDirectory(link + string(filepath.Separator))
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Errorf("DeleteSafeDirectory through a symlink = %v, want ErrOutsideSafetyPath", err)
+	}
+
+	if readTestFile(t, victim) != "keep" || readTestFile(t, filepath.Join(outside, "inner.txt")) != "keep" {
+		t.Fatal("file outside the safety path was deleted")
+	}
+
+	// A link is refused as well when its target leaves the safety path.
+	err = DeleteSafeFile(link)
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Errorf("DeleteSafeFile of a link leaving the safety path = %v, want ErrOutsideSafetyPath", err)
+	}
+}
+
+func TestGetDirSize(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "12345")
+	writeTestFile(t, filepath.Join(dir, "sub", "b.txt"), "1234567890")
+	writeTestFile(t, filepath.Join(dir, "sub", "deeper", "c.txt"), "")
+
+	size, err := GetDirSize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 15 {
+		t.Fatalf("got size %d, want 15", size)
+	}
+}
+
+func TestGetDirSizeSkipsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "12345")
+	symlinkOrSkip(t, filepath.Join(dir, "a.txt"), filepath.Join(dir, "link.txt"))
+
+	size, err := GetDirSize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 5 {
+		t.Fatalf("got size %d, want 5", size)
+	}
+}
+
+func TestGetDirSizeMissing(t *testing.T) {
+	_, err := GetDirSize(filepath.Join(t.TempDir(), "missing"))
+	if err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+}
+
+func TestFileExistsAndDirExists(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	writeTestFile(t, file, "data")
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		path       string
+		wantFile   bool
+		wantFolder bool
+	}{
+		{file, true, false},
+		{dir, false, true},
+		{missing, false, false},
+	}
+	for _, test := range tests {
+		isFile, err := FileExists(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isFile != test.wantFile {
+			t.Errorf("FileExists(%q) = %v, want %v", test.path, isFile, test.wantFile)
+		}
+
+		isFolder, err := DirExists(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isFolder != test.wantFolder {
+			t.Errorf("DirExists(%q) = %v, want %v", test.path, isFolder, test.wantFolder)
+		}
+	}
+}
+
+// Fails the test if the modification time of path is not within a second of want.
+func assertModTime(t *testing.T, path string, want time.Time) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := info.ModTime().Sub(want)
+	if diff < -time.Second || diff > time.Second {
+		t.Fatalf("%s has mtime %v, want %v", path, info.ModTime(), want)
+	}
+}
+
+func TestCopyFolderContentsPreserveTimes(t *testing.T) {
+	source := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "copy")
+	writeTestFile(t, filepath.Join(source, "sub", "a.txt"), "a")
+
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, path := range []string{filepath.Join(source, "sub", "a.txt"), filepath.Join(source, "sub"), source} {
+		err := os.Chtimes(path, old, old)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := CopyFolderContentsWithOptions(source, dest, CopyOptions{PreserveTimes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertModTime(t, filepath.Join(dest, "sub", "a.txt"), old)
+	assertModTime(t, filepath.Join(dest, "sub"), old)
+	assertModTime(t, dest, old)
+}
+
+func TestCopyFolderContentsDefaultTimes(t *testing.T) {
+	source := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "copy")
+	writeTestFile(t, filepath.Join(source, "a.txt"), "a")
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := os.Chtimes(filepath.Join(source, "a.txt"), old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CopyFolderContents(source, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dest, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ModTime().Equal(old) {
+		t.Fatal("modification time was preserved without PreserveTimes")
+	}
+}
+
+func TestGetDirContentsFilteredPattern(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir, "b.log"), "b")
+	writeTestFile(t, filepath.Join(dir, "c.txt"), "c")
+	writeTestFile(t, filepath.Join(dir, "dir.txt", "inner"), "d")
+
+	files, err := GetDirContentsFiltered(dir, false, ListOptions{Pattern: "*.txt", FilesOnly: true, Sort: SortNameAsc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0] != "a.txt" || files[1] != "c.txt" {
+		t.Fatalf("got %v, want [a.txt c.txt]", files)
+	}
+
+	dirs, err := GetDirContentsFiltered(dir, true, ListOptions{DirsOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 1 || dirs[0] != filepath.Join(dir, "dir.txt") {
+		t.Fatalf("got %v, want [%s]", dirs, filepath.Join(dir, "dir.txt"))
+	}
+
+	_, err = GetDirContentsFiltered(dir, false, ListOptions{Pattern: "["})
+	if err == nil {
+		t.Fatal("expected an error for a malformed pattern")
+	}
+}
+
+func TestGetDirContentsFilteredSort(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"b.txt", "c.txt", "a.txt"} {
+		path := filepath.Join(dir, name)
+		writeTestFile(t, path, name)
+		modTime := base.Add(time.Duration(i) * time.Hour)
+		err := os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sort SortOrder
+		want []string
+	}{
+		{SortNameAsc, []string{"a.txt", "b.txt", "c.txt"}},
+		{SortNameDesc, []string{"c.txt", "b.txt", "a.txt"}},
+		{SortModTimeAsc, []string{"b.txt", "c.txt", "a.txt"}},
+		{SortModTimeDesc, []string{"a.txt", "c.txt", "b.txt"}},
+	}
+	for _, test := range tests {
+		files, err := GetDirContentsFiltered(dir, false, ListOptions{Sort: test.sort})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range test.want {
+			if i >= len(files) || files[i] != test.want[i] {
+				t.Errorf("sort %d got %v, want %v", test.sort, files, test.want)
+				break
+			}
+		}
+	}
+}
+
+// Replaces the clock with a fixed time for the duration of a test.
+func useClock(t *testing.T, now time.Time) {
+	t.Helper()
+	t.Cleanup(func() { SetClock(nil) })
+	SetClock(func() time.Time { return now })
+}
+
+func TestGetTimeMicro(t *testing.T) {
+	useClock(t, time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC))
+
+	micro := GetTimeMicro()
+	if micro != "07:08:09.123456" {
+		t.Fatalf("got %q, want 07:08:09.123456", micro)
+	}
+	fraction := micro[strings.LastIndex(micro, ".")+1:]
+	if len(fraction) != 6 {
+		t.Fatalf("got %d fractional digits, want 6", len(fraction))
+	}
+
+	if GetTime() != "07:08:09:00" {
+		t.Fatalf("got %q, want the stable 07:08:09:00", GetTime())
+	}
+}
+
+func TestMoveDirectoryRename(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	dest := filepath.Join(root, "dest")
+	writeTestFile(t, filepath.Join(source, "sub", "a.txt"), "a")
+
+	err := MoveDirectory(source, dest, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, filepath.Join(dest, "sub", "a.txt")) != "a" {
+		t.Fatal("moved file has the wrong contents")
+	}
+	exists, err := DirExists(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("source still exists after the move")
+	}
+}
+
+func TestMoveDirectoryMerge(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	dest := filepath.Join(root, "dest")
+	writeTestFile(t, filepath.Join(source, "shared.txt"), "new")
+	writeTestFile(t, filepath.Join(source, "sub", "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dest, "shared.txt"), "old")
+	writeTestFile(t, filepath.Join(dest, "kept.txt"), "kept")
+
+	err := MoveDirectory(source, dest, false)
+	if !errors.Is(err, ErrDestExists) {
+		t.Fatalf("got %v, want ErrDestExists", err)
+	}
+	if readTestFile(t, filepath.Join(dest, "shared.txt")) != "old" {
+		t.Fatal("conflicting file was overwritten without merge")
+	}
+	if readTestFile(t, filepath.Join(source, "sub", "a.txt")) != "a" {
+		t.Fatal("source was modified by a failed move")
+	}
+
+	err = MoveDirectory(source, dest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, filepath.Join(dest, "shared.txt")) != "new" {
+		t.Fatal("conflicting file was not overwritten by merge")
+	}
+	if readTestFile(t, filepath.Join(dest, "kept.txt")) != "kept" || readTestFile(t, filepath.Join(dest, "sub", "a.txt")) != "a" {
+		t.Fatal("merged destination is missing files")
+	}
+	_, err = os.Stat(source)
+	if !os.IsNotExist(err) {
+		t.Fatalf("source still exists after the merge: %v", err)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hello.txt")
+	writeTestFile(t, path, "hello")
+
+	tests := []struct {
+		algo string
+		want string
+	}{
+		{"md5", "5d41402abc4b2a76b9719d911017c592"},
+		{"sha1", "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{"SHA256", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	}
+	for _, test := range tests {
+		digest, err := HashFile(path, test.algo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if digest != test.want {
+			t.Errorf("HashFile %s = %s, want %s", test.algo, digest, test.want)
+		}
+	}
+
+	_, err := HashFile(path, "crc32")
+	if !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Fatalf("got %v, want ErrUnsupportedAlgorithm", err)
+	}
+}
+
+func TestDirectoriesEqual(t *testing.T) {
+	a := t.TempDir()
+	b := t.TempDir()
+	for _, dir := range []string{a, b} {
+		writeTestFile(t, filepath.Join(dir, "same.txt"), "same")
+		writeTestFile(t, filepath.Join(dir, "sub", "nested.txt"), "nested")
+	}
+
+	equal, diffs, err := DirectoriesEqual(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal || len(diffs) != 0 {
+		t.Fatalf("identical trees reported as different: %v", diffs)
+	}
+
+	writeTestFile(t, filepath.Join(b, "sub", "nested.txt"), "nestex")
+	writeTestFile(t, filepath.Join(a, "extra.txt"), "extra")
+	equal, diffs, err = DirectoriesEqual(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if equal {
+		t.Fatal("different trees reported as equal")
+	}
+	want := []string{"extra.txt", filepath.Join("sub", "nested.txt")}
+	if len(diffs) != 2 || diffs[0] != want[0] || diffs[1] != want[1] {
+		t.Fatalf("got diffs %v, want %v", diffs, want)
+	}
+}
+
+func TestAppendToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.txt")
+
+	err := AppendToFile(path, []byte("first\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AppendToFile(path, []byte("second\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, path) != "first\nsecond\n" {
+		t.Fatalf("got %q, want both appends", readTestFile(t, path))
+	}
+}
+
+func TestCopyStream(t *testing.T) {
+	source := bytes.NewBufferString(strings.Repeat("dirkit", 10000))
+	var dest bytes.Buffer
+
+	written, err := CopyStream(&dest, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 60000 || dest.String() != strings.Repeat("dirkit", 10000) {
+		t.Fatalf("copied %d bytes, want 60000 matching bytes", written)
+	}
+}
+
+func TestCopyFileProgress(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "large.bin")
+	dest := filepath.Join(dir, "copy.bin")
+	data := strings.Repeat("x", 200*1024)
+	writeTestFile(t, source, data)
+
+	var calls []int64
+	err := CopyFileProgress(source, dest, func(copied, total int64) {
+		if total != int64(len(data)) {
+			t.Errorf("got total %d, want %d", total, len(data))
+		}
+		calls = append(calls, copied)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) < 2 {
+		t.Fatalf("got %d progress calls, want at least 2", len(calls))
+	}
+	for i := 1; i < len(calls); i++ {
+		if calls[i] < calls[i-1] {
+			t.Fatalf("progress decreased: %v", calls)
+		}
+	}
+	if calls[len(calls)-1] != int64(len(data)) {
+		t.Fatalf("final progress %d, want %d", calls[len(calls)-1], len(data))
+	}
+	if readTestFile(t, dest) != data {
+		t.Fatal("copy does not have the source contents")
+	}
+}
+
+// Writes a zip archive holding the given entry names and contents.
+func writeTestZip(t *testing.T, path string, entries map[string]string) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	for name, data := range entries {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = entry.Write([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnzip(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "archive.zip")
+	dest := filepath.Join(dir, "out")
+	writeTestZip(t, archive, map[string]string{"a.txt": "a", "sub/b.txt": "b", "empty/": ""})
+
+	err := Unzip(archive, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, filepath.Join(dest, "a.txt")) != "a" || readTestFile(t, filepath.Join(dest, "sub", "b.txt")) != "b" {
+		t.Fatal("extracted files have the wrong contents")
+	}
+	exists, err := DirExists(filepath.Join(dest, "empty"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("directory entry was not extracted")
+	}
+}
+
+func TestUnzipRejectsTraversal(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "evil.zip")
+	dest := filepath.Join(dir, "out")
+	writeTestZip(t, archive, map[string]string{"../evil.txt": "evil"})
+
+	err := Unzip(archive, dest)
+	if !errors.Is(err, ErrPathEscapes) {
+		t.Fatalf("got %v, want ErrPathEscapes", err)
+	}
+	_, err = os.Stat(filepath.Join(dir, "evil.txt"))
+	if !os.IsNotExist(err) {
+		t.Fatal("archive entry was written outside the destination")
+	}
+}
+
+func TestUnzipDirectoryModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires unix file permissions")
+	}
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "archive.zip")
+	dest := filepath.Join(dir, "out")
+
+	// The sub directory entry comes after a file that implicitly creates it, and the
+	// read-only directory entry comes before the file extracted into it.
+	entries := []struct {
+		name string
+		mode os.FileMode
+		data string
+	}{
+		{"sub/a.txt", 0644, "a"},
+		{"sub/", os.ModeDir | 0700, ""},
+		{"readonly/", os.ModeDir | 0555, ""},
+		{"readonly/b.txt", 0644, "b"},
+	}
+	file, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := zip.NewWriter(file)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		header.SetMode(entry.mode)
+		entryWriter, err := writer.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = entryWriter.Write([]byte(entry.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+	file.Close()
+
+	t.Cleanup(func() { os.Chmod(filepath.Join(dest, "readonly"), 0777) })
+	err = Unzip(archive, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, filepath.Join(dest, "readonly", "b.txt")) != "b" {
+		t.Fatal("file in the read-only directory has the wrong contents")
+	}
+	modes := map[string]os.FileMode{"sub": 0700, "readonly": 0555}
+	for name, want := range modes {
+		info, err := os.Stat(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s has mode %v, want %v", name, info.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestRenameSafeFile(t *testing.T) {
+	dir := useSafetyPath(t)
+	oldPath := filepath.Join(dir, "old.txt")
+	newPath := filepath.Join(dir, "new.txt")
+	writeTestFile(t, oldPath, "data")
+
+	err := RenameSafeFile(oldPath, newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, newPath) != "data" {
+		t.Fatal("renamed file has the wrong contents")
+	}
+}
+
+func TestRenameSafeFileOutside(t *testing.T) {
+	dir := useSafetyPath(t)
+	inside := filepath.Join(dir, "inside.txt")
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	writeTestFile(t, inside, "inside")
+	writeTestFile(t, outside, "outside")
+
+	err := RenameSafeFile(inside, filepath.Join(filepath.Dir(outside), "moved.txt"))
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("renaming out of the safety path got %v, want ErrOutsideSafetyPath", err)
+	}
+	err = RenameSafeFile(outside, filepath.Join(dir, "moved.txt"))
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("renaming into the safety path got %v, want ErrOutsideSafetyPath", err)
+	}
+	if readTestFile(t, inside) != "inside" || readTestFile(t, outside) != "outside" {
+		t.Fatal("a rejected rename moved a file")
+	}
+}
+
+func TestTrailingSeparators(t *testing.T) {
+	tests := []struct {
+		path   string
+		ensure string
+		trim   string
+	}{
+		{"", "", ""},
+		{"/", "/", "/"},
+		{"/data", "/data/", "/data"},
+		{"/data/", "/data/", "/data"},
+		{"/data//", "/data//", "/data"},
+		{"data", "data/", "data"},
+	}
+	if runtime.GOOS == "windows" {
+		tests = []struct {
+			path   string
+			ensure string
+			trim   string
+		}{
+			{"", "", ""},
+			{`C:\`, `C:\`, `C:\`},
+			{`C:\data`, `C:\data\`, `C:\data`},
+			{`C:\data\`, `C:\data\`, `C:\data`},
+			{`C:/data/`, `C:/data/`, `C:/data`},
+			{`data`, `data\`, `data`},
+		}
+	}
+
+	for _, test := range tests {
+		ensured := EnsureTrailingSeparator(test.path)
+		if ensured != test.ensure {
+			t.Errorf("EnsureTrailingSeparator(%q) = %q, want %q", test.path, ensured, test.ensure)
+		}
+		trimmed := TrimTrailingSeparator(test.path)
+		if trimmed != test.trim {
+			t.Errorf("TrimTrailingSeparator(%q) = %q, want %q", test.path, trimmed, test.trim)
+		}
+	}
+}
+
+func TestCopyFolderContentsContextCancel(t *testing.T) {
+	source := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "copy")
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		writeTestFile(t, filepath.Join(source, name), name)
+	}
+
+	// Cancel once the first file has been copied.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	t.Cleanup(func() { SetLogger(nil) })
+	SetLogger(func(op string, path string, err error) {
+		if op == "CopyFileOverWrite" {
+			cancel()
+		}
+	})
+
+	err := CopyFolderContentsContext(ctx, source, dest)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	copied, err := GetDirContents(dest, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copied) != 1 {
+		t.Fatalf("got %d copied files, want the 1 copied before cancelling", len(copied))
+	}
+}
+
+func TestCreateTempDir(t *testing.T) {
+	path, cleanup, err := CreateTempDir("dirkit-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
+
+	writeTestFile(t, path+string(os.PathSeparator)+"file.txt", "data")
+	cleanup()
+	cleanup()
+
+	_, err = os.Stat(path)
+	if !os.IsNotExist(err) {
+		t.Fatalf("temp dir still exists after cleanup: %v", err)
+	}
+}
+
+func TestCreateDatedDirectoryPath(t *testing.T) {
+	useClock(t, time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC))
+	dir := t.TempDir()
+
+	path, err := CreateDatedDirectoryPath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, GetDate()) || path != filepath.Join(dir, "20240115") {
+		t.Fatalf("got %s, want %s", path, filepath.Join(dir, "20240115"))
+	}
+	exists, err := DirExists(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("dated directory was not created")
+	}
+}
+
+func TestCreateDatedDirectoryFormat(t *testing.T) {
+	useClock(t, time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC))
+	dir := t.TempDir()
+
+	path, err := CreateDatedDirectoryFormat(dir, "2006/01/02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, "2024", "01", "15") {
+		t.Fatalf("got %s, want %s", path, filepath.Join(dir, "2024", "01", "15"))
+	}
+	for _, level := range []string{"2024", filepath.Join("2024", "01"), filepath.Join("2024", "01", "15")} {
+		exists, err := DirExists(filepath.Join(dir, level))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Fatalf("directory level %s was not created", level)
+		}
+	}
+}
+
+func TestCreateDatedDirectoryFormatInvalid(t *testing.T) {
+	useClock(t, time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC))
+	dir := t.TempDir()
+
+	_, err := CreateDatedDirectoryFormat(dir, "15:04")
+	if err == nil {
+		t.Fatal("expected an error for a layout with illegal characters")
+	}
+	_, err = CreateDatedDirectoryFormat(dir, "../2006")
+	if !errors.Is(err, ErrPathEscapes) {
+		t.Fatalf("got %v, want ErrPathEscapes", err)
+	}
+}
+
+func TestFindFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "main.go"), "package main")
+	writeTestFile(t, filepath.Join(dir, "readme.md"), "readme")
+	writeTestFile(t, filepath.Join(dir, "pkg", "util.go"), "package pkg")
+	writeTestFile(t, filepath.Join(dir, "pkg", "util.go.bak"), "backup")
+	writeTestFile(t, filepath.Join(dir, "dir.go", "notes.txt"), "notes")
+
+	matches, err := FindFiles(dir, "*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, matches, []string{filepath.Join(dir, "main.go"), filepath.Join(dir, "pkg", "util.go")})
+
+	_, err = FindFiles(dir, "[")
+	if err == nil {
+		t.Fatal("expected an error for a malformed pattern")
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"lf.txt":     "one\ntwo\nthree\n",
+		"crlf.txt":   "one\r\ntwo\r\nthree\r\n",
+		"no-end.txt": "one\ntwo\nthree",
+		"mixed.txt":  "one\r\ntwo\nthree",
+	}
+	for name, data := range tests {
+		path := filepath.Join(dir, name)
+		writeTestFile(t, path, data)
+
+		lines, err := ReadLines(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != 3 || lines[0] != "one" || lines[1] != "two" || lines[2] != "three" {
+			t.Errorf("%s: got %q, want [one two three]", name, lines)
+		}
+	}
+}
+
+func TestWriteLinesRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lines.txt")
+	want := []string{"alpha", "", "gamma"}
+
+	err := WriteLines(path, want, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, path) != "alpha"+lineEnding+lineEnding+"gamma"+lineEnding {
+		t.Fatalf("got %q, want lines ending with the OS line ending", readTestFile(t, path))
+	}
+	lines, err := ReadLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 || lines[0] != want[0] || lines[1] != want[1] || lines[2] != want[2] {
+		t.Fatalf("got %q, want %q", lines, want)
+	}
+
+	err = WriteLines(path, []string{"other"}, false)
+	if !errors.Is(err, ErrDestExists) {
+		t.Fatalf("got %v, want ErrDestExists", err)
+	}
+	err = WriteLines(path, []string{"other"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, path) != "other"+lineEnding {
+		t.Fatal("file was not overwritten")
+	}
+}
+
+func TestInfo(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	writeTestFile(t, file, "12345")
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := os.Chtimes(file, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := Info(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Name != "file.txt" || meta.FullPath != file || meta.Size != 5 || meta.IsDir {
+		t.Fatalf("got %+v for a file", meta)
+	}
+	if !meta.ModTime.Equal(modTime) || !meta.Mode.IsRegular() {
+		t.Fatalf("got mod time %v and mode %v", meta.ModTime, meta.Mode)
+	}
+
+	meta, err = Info(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Name != filepath.Base(dir) || meta.FullPath != dir || !meta.IsDir || !meta.Mode.IsDir() {
+		t.Fatalf("got %+v for a directory", meta)
+	}
+
+	_, err = Info(filepath.Join(dir, "missing"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestDeleteSafeFilesInDirectory(t *testing.T) {
+	dir := useSafetyPath(t)
+	writeTestFile(t, filepath.Join(dir, "top.txt"), "top")
+	writeTestFile(t, filepath.Join(dir, "sub", "nested.txt"), "nested")
+
+	err := DeleteSafeFilesInDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := WalkDirContents(dir, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, files, []string{filepath.Join("sub", "nested.txt")})
+}
+
+func TestDeleteSafeFilesInDirectoryRecursive(t *testing.T) {
+	dir := useSafetyPath(t)
+	writeTestFile(t, filepath.Join(dir, "top.txt"), "top")
+	writeTestFile(t, filepath.Join(dir, "sub", "nested.txt"), "nested")
+	writeTestFile(t, filepath.Join(dir, "sub", "deeper", "deep.txt"), "deep")
+
+	err := DeleteSafeFilesInDirectoryRecursive(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining, err := WalkDirContents(dir, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, remaining, []string{"sub", filepath.Join("sub", "deeper")})
+}
+
+func TestCopyFolderContentsSymlinks(t *testing.T) {
+	source := t.TempDir()
+	outside := t.TempDir()
+	writeTestFile(t, filepath.Join(source, "file.txt"), "file")
+	writeTestFile(t, filepath.Join(outside, "linked.txt"), "linked")
+	symlinkOrSkip(t, filepath.Join(source, "file.txt"), filepath.Join(source, "file-link.txt"))
+	symlinkOrSkip(t, outside, filepath.Join(source, "dir-link"))
+
+	skipped := filepath.Join(t.TempDir(), "skip")
+	err := CopyFolderContentsWithOptions(source, skipped, CopyOptions{Symlinks: SymlinkSkip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := GetDirContents(skipped, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, contents, []string{"file.txt"})
+
+	copied := filepath.Join(t.TempDir(), "copy")
+	err = CopyFolderContentsWithOptions(source, copied, CopyOptions{Symlinks: SymlinkCopy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := os.Readlink(filepath.Join(copied, "dir-link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != outside {
+		t.Fatalf("copied link points to %s, want %s", target, outside)
+	}
+
+	followed := filepath.Join(t.TempDir(), "follow")
+	err = CopyFolderContentsWithOptions(source, followed, CopyOptions{Symlinks: SymlinkFollow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(filepath.Join(followed, "dir-link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || readTestFile(t, filepath.Join(followed, "dir-link", "linked.txt")) != "linked" {
+		t.Fatal("followed directory link was not deep copied")
+	}
+	if readTestFile(t, filepath.Join(followed, "file-link.txt")) != "file" {
+		t.Fatal("followed file link was not copied")
+	}
+}
+
+func TestCopyFolderContentsSymlinkCycle(t *testing.T) {
+	source := t.TempDir()
+	writeTestFile(t, filepath.Join(source, "sub", "file.txt"), "file")
+	symlinkOrSkip(t, source, filepath.Join(source, "sub", "loop"))
+
+	err := CopyFolderContentsWithOptions(source, filepath.Join(t.TempDir(), "copy"), CopyOptions{Symlinks: SymlinkFollow})
+	if !errors.Is(err, ErrSymlinkCycle) {
+		t.Fatalf("got %v, want ErrSymlinkCycle", err)
+	}
+
+	err = CopyFolderContents(source, filepath.Join(t.TempDir(), "skip"))
+	if err != nil {
+		t.Fatalf("skipping symlinks should avoid the cycle: %v", err)
+	}
+}
+
+func TestExportMapToJsonWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json")
+	writeTestFile(t, path, `{"old":true}`)
+
+	// Write part of the data before failing, as a crash or full disk would.
+	writeErr := errors.New("disk full")
+	previous := writeTemp
+	t.Cleanup(func() { writeTemp = previous })
+	writeTemp = func(file *os.File, data []byte) error {
+		file.Write(data[:len(data)/2])
+		return writeErr
+	}
+
+	err := ExportMapToJson(path, map[string]interface{}{"new": true}, true)
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("got %v, want the injected write error", err)
+	}
+	if readTestFile(t, path) != `{"old":true}` {
+		t.Fatalf("existing file was changed to %q", readTestFile(t, path))
+	}
+
+	missing := filepath.Join(dir, "missing.json")
+	err = ExportMapToJson(missing, map[string]interface{}{"new": true}, false)
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("got %v, want the injected write error", err)
+	}
+	contents, err := GetDirContents(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, contents, []string{"data.json"})
+}
+
+func TestTouch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "touched.txt")
+
+	err := Touch(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Fatalf("new file has size %d, want 0", info.Size())
+	}
+
+	old := time.Now().Add(-time.Hour)
+	err = os.Chtimes(path, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Touch(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().After(old.Add(time.Minute)) {
+		t.Fatalf("mtime %v did not advance from %v", info.ModTime(), old)
+	}
+}
+
+func TestCopyFiles(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.txt")
+	missing := filepath.Join(dir, "missing.txt")
+	writeTestFile(t, good, "good")
+
+	failures, err := CopyFiles([][2]string{
+		{missing, filepath.Join(dir, "missing-copy.txt")},
+		{good, filepath.Join(dir, "good-copy.txt")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[missing] == nil {
+		t.Fatalf("got failures %v, want only %s", failures, missing)
+	}
+	if readTestFile(t, filepath.Join(dir, "good-copy.txt")) != "good" {
+		t.Fatal("valid pair was not copied after an earlier failure")
+	}
+
+	_, err = CopyFiles([][2]string{{good, ""}})
+	if err == nil {
+		t.Fatal("expected an error for an empty destination")
+	}
+}
+
+func TestIsDirEmpty(t *testing.T) {
+	dir := t.TempDir()
+
+	empty, err := IsDirEmpty(dir)
+	if err != nil || !empty {
+		t.Fatalf("got %v, %v for an empty directory", empty, err)
+	}
+
+	file := filepath.Join(dir, "file.txt")
+	writeTestFile(t, file, "data")
+	empty, err = IsDirEmpty(dir)
+	if err != nil || empty {
+		t.Fatalf("got %v, %v for a non-empty directory", empty, err)
+	}
+
+	_, err = IsDirEmpty(filepath.Join(dir, "missing"))
+	if err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+	_, err = IsDirEmpty(file)
+	if err == nil {
+		t.Fatal("expected an error for a file")
+	}
+}
+
+func TestMirrorDirectory(t *testing.T) {
+	dir := useSafetyPath(t)
+	source := t.TempDir()
+	dest := filepath.Join(dir, "mirror")
+	writeTestFile(t, filepath.Join(source, "same.txt"), "same")
+	writeTestFile(t, filepath.Join(source, "changed.txt"), "original")
+	writeTestFile(t, filepath.Join(source, "removed.txt"), "removed")
+	writeTestFile(t, filepath.Join(source, "gone", "nested.txt"), "nested")
+
+	err := MirrorDirectory(source, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, filepath.Join(source, "added.txt"), "added")
+	writeTestFile(t, filepath.Join(source, "changed.txt"), "modified!")
+	later := time.Now().Add(time.Hour)
+	err = os.Chtimes(filepath.Join(source, "changed.txt"), later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(filepath.Join(source, "removed.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.RemoveAll(filepath.Join(source, "gone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = MirrorDirectory(source, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal, diffs, err := DirectoriesEqual(source, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal {
+		t.Fatalf("mirror differs from source: %v", diffs)
+	}
+	items, err := WalkDirContents(dest, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, items, []string{"added.txt", "changed.txt", "same.txt"})
+}
+
+func TestMirrorDirectoryDoesNotFollowDestSymlinks(t *testing.T) {
+	dir := useSafetyPath(t)
+	source := t.TempDir()
+	dest := filepath.Join(dir, "mirror")
+	victim := filepath.Join(t.TempDir(), "victim.txt")
+	writeTestFile(t, filepath.Join(source, "file.txt"), "source")
+	writeTestFile(t, victim, "keep")
+	err := os.Mkdir(dest, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	symlinkOrSkip(t, victim, filepath.Join(dest, "file.txt"))
+
+	err = MirrorDirectory(source, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, victim) != "keep" {
+		t.Fatal("mirror wrote through a symlink in the destination")
+	}
+	if readTestFile(t, filepath.Join(dest, "file.txt")) != "source" {
+		t.Fatal("symlink in the destination was not replaced")
+	}
+}
+
+func TestMirrorDirectoryOutside(t *testing.T) {
+	useSafetyPath(t)
+
+	err := MirrorDirectory(t.TempDir(), t.TempDir())
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("got %v, want ErrOutsideSafetyPath", err)
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	dir := useSafetyPath(t)
+	outside := t.TempDir()
+	writeTestFile(t, filepath.Join(outside, "file.txt"), "data")
+
+	safeCalls := map[string]func() error{
+		"DeleteSafeDirectory": func() error { return DeleteSafeDirectory(outside) },
+		"DeleteSafeFile":      func() error { return DeleteSafeFile(filepath.Join(outside, "file.txt")) },
+		"DeleteSafeFilesInDirectory": func() error {
+			return DeleteSafeFilesInDirectory(outside)
+		},
+		"TruncateSafeFile": func() error { return TruncateSafeFile(filepath.Join(outside, "file.txt")) },
+	}
+	for name, call := range safeCalls {
+		err := call()
+		if !errors.Is(err, ErrOutsideSafetyPath) {
+			t.Errorf("%s got %v, want ErrOutsideSafetyPath", name, err)
+		}
+	}
+
+	source := filepath.Join(dir, "source.txt")
+	writeTestFile(t, source, "data")
+	err := CopyFileOverWrite(source, filepath.Join(outside, "file.txt"), false)
+	if !errors.Is(err, ErrDestExists) {
+		t.Errorf("CopyFileOverWrite got %v, want ErrDestExists", err)
+	}
+}
+
+func TestGetDirContentsDepth(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir, "one", "b.txt"), "b")
+	writeTestFile(t, filepath.Join(dir, "one", "two", "c.txt"), "c")
+
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{"a.txt", "one"}},
+		{1, []string{"a.txt", "one", filepath.Join("one", "b.txt"), filepath.Join("one", "two")}},
+		{-1, []string{
+			"a.txt",
+			"one",
+			filepath.Join("one", "b.txt"),
+			filepath.Join("one", "two"),
+			filepath.Join("one", "two", "c.txt"),
+		}},
+	}
+	for _, test := range tests {
+		contents, err := GetDirContentsDepth(dir, false, test.depth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSameItems(t, contents, test.want)
+	}
+
+	full, err := GetDirContentsDepth(dir, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, full, []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "one")})
+}
+
+func TestTrashFileAndDirectory(t *testing.T) {
+	dir := useSafetyPath(t)
+	file := filepath.Join(dir, "file.txt")
+	folder := filepath.Join(dir, "folder")
+	writeTestFile(t, file, "file")
+	writeTestFile(t, filepath.Join(folder, "nested.txt"), "nested")
+
+	err := TrashFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = TrashDirectory(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trashed, err := FindFiles(filepath.Join(dir, trashDirName), "*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trashed) != 2 {
+		t.Fatalf("got trashed files %v, want file.txt and nested.txt", trashed)
+	}
+	for _, path := range []string{file, folder} {
+		exists, err := pathExists(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Fatalf("%s still exists after being trashed", path)
+		}
+	}
+
+	err = EmptyTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err := DirExists(filepath.Join(dir, trashDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("trash still exists after EmptyTrash")
+	}
+}
+
+func TestTrashFileOutside(t *testing.T) {
+	useSafetyPath(t)
+	file := filepath.Join(t.TempDir(), "file.txt")
+	writeTestFile(t, file, "keep")
+
+	err := TrashFile(file)
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("got %v, want ErrOutsideSafetyPath", err)
+	}
+}
+
+func TestChecksumManifest(t *testing.T) {
+	root := t.TempDir()
+	manifest := filepath.Join(root, "manifest.sha256")
+	writeTestFile(t, filepath.Join(root, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(root, "sub", "b.txt"), "b")
+	writeTestFile(t, filepath.Join(root, "sub", "c.txt"), "c")
+
+	err := WriteChecksumManifest(root, manifest, "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := ReadLines(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("got manifest %q, want 3 lines", lines)
+	}
+
+	failed, err := VerifyChecksumManifest(root, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 0 {
+		t.Fatalf("untouched tree failed verification: %v", failed)
+	}
+
+	writeTestFile(t, filepath.Join(root, "sub", "b.txt"), "tampered")
+	err = os.Remove(filepath.Join(root, "sub", "c.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed, err = VerifyChecksumManifest(root, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, failed, []string{"sub/b.txt", "sub/c.txt"})
+}
+
+func TestGlobSafe(t *testing.T) {
+	dir := useSafetyPath(t)
+	outside := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(outside, "b.txt"), "b")
+
+	matches, err := GlobSafe(filepath.Join(filepath.Dir(dir), "*", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, matches, []string{filepath.Join(dir, "a.txt")})
+
+	matches, err = GlobSafe(filepath.Join(outside, "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matches == nil || len(matches) != 0 {
+		t.Fatalf("got %#v, want an empty slice", matches)
+	}
+}
+
+func TestWithFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.txt")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			err := WithFileLock(path, func() error {
+				err := AppendToFile(path, []byte(fmt.Sprintf("start %d\n", id)))
+				if err != nil {
+					return err
+				}
+				time.Sleep(time.Millisecond)
+				return AppendToFile(path, []byte(fmt.Sprintf("end %d\n", id)))
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines, err := ReadLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 16 {
+		t.Fatalf("got %d lines, want 16", len(lines))
+	}
+	for i := 0; i < len(lines); i += 2 {
+		id := strings.TrimPrefix(lines[i], "start ")
+		if lines[i+1] != "end "+id {
+			t.Fatalf("writes were interleaved: %q", lines)
+		}
+	}
+}
+
+func TestCopyFolderContentsParallel(t *testing.T) {
+	source := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "copy")
+	for i := 0; i < 50; i++ {
+		path := filepath.Join(source, fmt.Sprintf("dir%d", i%5), fmt.Sprintf("file%d.txt", i))
+		writeTestFile(t, path, strings.Repeat(fmt.Sprint(i), 1000+i))
+	}
+	writeTestFile(t, filepath.Join(source, "empty", "deeper", "file.txt"), "")
+
+	err := CopyFolderContentsParallel(source, dest, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal, diffs, err := DirectoriesEqual(source, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal {
+		t.Fatalf("parallel copy differs from source: %v", diffs)
+	}
+}
+
+func TestCopyFolderContentsParallelMissingSource(t *testing.T) {
+	err := CopyFolderContentsParallel(filepath.Join(t.TempDir(), "missing"), t.TempDir(), 4)
+	if err == nil {
+		t.Fatal("expected an error for a missing source")
+	}
+}
+
+func TestImportJsonArray(t *testing.T) {
+	dir := t.TempDir()
+
+	structs := filepath.Join(dir, "structs.json")
+	writeTestFile(t, structs, `[{"name":"a","retries":1},{"name":"b","retries":2}]`)
+	configs, err := ImportJsonArray[testConfig](structs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 || configs[0].Name != "a" || configs[1].Retries != 2 {
+		t.Fatalf("got %+v", configs)
+	}
+
+	strs := filepath.Join(dir, "strings.json")
+	writeTestFile(t, strs, ` ["x", "y"]`)
+	values, err := ImportJsonArray[string](strs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values[0] != "x" || values[1] != "y" {
+		t.Fatalf("got %v, want [x y]", values)
+	}
+
+	object := filepath.Join(dir, "object.json")
+	writeTestFile(t, object, `{"name":"a"}`)
+	_, err = ImportJsonArray[string](object)
+	if !errors.Is(err, ErrInvalidJson) {
+		t.Fatalf("got %v, want ErrInvalidJson", err)
+	}
+}
+
+func TestCreateDirectoryMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permission bits are not supported")
+	}
+	path := filepath.Join(t.TempDir(), "private")
+
+	err := CreateDirectoryMode(path, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The umask can only remove bits, so nothing beyond 0700 may be set.
+	if info.Mode().Perm()&^0700 != 0 || info.Mode().Perm()&0700 == 0 {
+		t.Fatalf("got mode %v, want at most 0700", info.Mode().Perm())
+	}
+
+	err = CreateDirectoryMode(path, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&^0700 != 0 {
+		t.Fatal("existing directory permissions were changed")
+	}
+}
+
+func TestGetDirContentsRelative(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir, "sub", "deeper", "b.txt"), "b")
+
+	files, err := GetDirContentsRelative(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, files, []string{"a.txt", "sub/deeper/b.txt"})
+}
+
+func TestTruncateSafeFile(t *testing.T) {
+	dir := useSafetyPath(t)
+	inside := filepath.Join(dir, "inside.txt")
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	writeTestFile(t, inside, "contents")
+	writeTestFile(t, outside, "contents")
+
+	err := TruncateSafeFile(inside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, inside) != "" {
+		t.Fatal("file was not truncated")
+	}
+
+	err = TruncateSafeFile(outside)
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("got %v, want ErrOutsideSafetyPath", err)
+	}
+	if readTestFile(t, outside) != "contents" {
+		t.Fatal("file outside the safety path was truncated")
+	}
+}
+
+func TestBackupFile(t *testing.T) {
+	useClock(t, time.Date(2024, 1, 15, 9, 30, 45, 0, time.UTC))
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, path, `{"a":1}`)
+
+	backupPath, err := BackupFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backupPath != path+".20240115-093045.bak" {
+		t.Fatalf("got %s, want %s", backupPath, path+".20240115-093045.bak")
+	}
+	if readTestFile(t, backupPath) != `{"a":1}` {
+		t.Fatal("backup does not match the original")
+	}
+
+	_, err = BackupFile(path)
+	if !errors.Is(err, ErrDestExists) {
+		t.Fatalf("second backup in the same second got %v, want ErrDestExists", err)
+	}
+	_, err = BackupFile(filepath.Join(filepath.Dir(path), "missing.json"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestCountLinesAndBytes(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		data  string
+		lines int
+	}{
+		{"", 0},
+		{"one", 1},
+		{"one\n", 1},
+		{"one\ntwo", 2},
+		{"one\ntwo\nthree\n", 3},
+		{"\n\n", 2},
+	}
+	for i, test := range tests {
+		path := filepath.Join(dir, string(rune('a'+i))+".txt")
+		writeTestFile(t, path, test.data)
+
+		lines, err := CountLines(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines != test.lines {
+			t.Errorf("CountLines(%q) = %d, want %d", test.data, lines, test.lines)
+		}
+		size, err := CountBytes(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != int64(len(test.data)) {
+			t.Errorf("CountBytes(%q) = %d, want %d", test.data, size, len(test.data))
+		}
+	}
+}
+
+func TestGetSubdirectories(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "file.txt"), "file")
+	for _, name := range []string{"one", "two"} {
+		err := os.Mkdir(filepath.Join(dir, name), 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := GetSubdirectories(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, names, []string{"one", "two"})
+
+	paths, err := GetSubdirectories(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, paths, []string{filepath.Join(dir, "one"), filepath.Join(dir, "two")})
+}
+
+func TestMergeMapToJson(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+
+	err := MergeMapToJson(path, map[string]interface{}{"a": "first", "b": "kept"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = MergeMapToJson(path, map[string]interface{}{"a": "second", "c": "added"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := ImportJsonToMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged) != 3 || merged["a"] != "second" || merged["b"] != "kept" || merged["c"] != "added" {
+		t.Fatalf("got %v", merged)
+	}
+
+	writeTestFile(t, path, "not json")
+	err = MergeMapToJson(path, map[string]interface{}{"a": 1})
+	if !errors.Is(err, ErrInvalidJson) {
+		t.Fatalf("got %v, want ErrInvalidJson", err)
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		path      string
+		normal    string
+		slashPath string
+	}{
+		{"a/b/../c", "a/c", "a/c"},
+		{`a/b\c/../d`, "a/d", "a/d"},
+		{`a\b/c`, `a\b/c`, `a\b/c`},
+		{"a//b/./c/", "a/b/c", "a/b/c"},
+	}
+	if runtime.GOOS == "windows" {
+		tests = []struct {
+			path      string
+			normal    string
+			slashPath string
+		}{
+			{"a/b/../c", `a\c`, "a/c"},
+			{`a/b\c/../d`, `a\b\d`, "a/b/d"},
+			{`a\b/c`, `a\b\c`, "a/b/c"},
+			{`C:/data\sub/`, `C:\data\sub`, "C:/data/sub"},
+		}
+	}
+
+	for _, test := range tests {
+		normal := NormalizePath(test.path)
+		if normal != test.normal {
+			t.Errorf("NormalizePath(%q) = %q, want %q", test.path, normal, test.normal)
+		}
+		slashPath := ToSlashPath(normal)
+		if slashPath != test.slashPath {
+			t.Errorf("ToSlashPath(%q) = %q, want %q", normal, slashPath, test.slashPath)
+		}
+	}
+}
+
+func TestSafetyPathMixedSeparators(t *testing.T) {
+	dir := useSafetyPath(t)
+	inside := filepath.ToSlash(filepath.Join(dir, "sub", "..", "file.txt"))
+	writeTestFile(t, filepath.Join(dir, "file.txt"), "data")
+
+	err := DeleteSafeFile(inside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err := FileExists(filepath.Join(dir, "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("file given with forward slashes was not deleted")
+	}
+}
+
+// Waits for the watcher to send path, failing the test after a timeout.
+func waitForEvent(t *testing.T, events <-chan string, path string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event == path {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no event received for %s", path)
+		}
+	}
+}
+
+func TestWatchDirInterval(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan string)
+	done := make(chan error)
+	go func() {
+		done <- WatchDirInterval(ctx, dir, 10*time.Millisecond, events)
+	}()
+
+	// Give the watcher time to take its first scan before changing anything.
+	time.Sleep(50 * time.Millisecond)
+	file := filepath.Join(dir, "file.txt")
+	writeTestFile(t, file, "created")
+	waitForEvent(t, events, file)
+
+	writeTestFile(t, file, "modified contents")
+	waitForEvent(t, events, file)
+
+	err := os.Remove(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, events, file)
+
+	cancel()
+	err = <-done
+	if err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestWatchDirIntervalNonPositive(t *testing.T) {
+	dir := t.TempDir()
+	for _, interval := range []time.Duration{0, -time.Second} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err := WatchDirInterval(ctx, dir, interval, make(chan string))
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("got %v for a %v interval, want context.DeadlineExceeded", err, interval)
+		}
+	}
+}
+
+func TestWriteSafeFile(t *testing.T) {
+	dir := useSafetyPath(t)
+	inside := filepath.Join(dir, "inside.txt")
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+
+	err := WriteSafeFile(inside, []byte("data"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, inside) != "data" {
+		t.Fatal("file was not written")
+	}
+	err = WriteSafeFile(inside, []byte("other"), false)
+	if !errors.Is(err, ErrDestExists) {
+		t.Fatalf("got %v, want ErrDestExists", err)
+	}
+
+	err = WriteSafeFile(outside, []byte("data"), true)
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("got %v, want ErrOutsideSafetyPath", err)
+	}
+	_, err = os.Stat(outside)
+	if !os.IsNotExist(err) {
+		t.Fatal("file outside the safety path was written")
+	}
+}
+
+func TestGetDirContentsByExt(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.TXT", "c.Txt", "d.log", "e"} {
+		writeTestFile(t, filepath.Join(dir, name), name)
+	}
+	writeTestFile(t, filepath.Join(dir, "folder.txt", "inner.txt"), "inner")
+
+	for _, ext := range []string{".txt", "TXT"} {
+		files, err := GetDirContentsByExt(dir, false, ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSameItems(t, files, []string{"a.txt", "b.TXT", "c.Txt"})
+	}
+
+	files, err := GetDirContentsByExt(dir, true, "log", ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("got %v, want the txt and log files", files)
+	}
+
+	all, err := GetDirContentsByExt(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 6 {
+		t.Fatalf("got %v, want every entry", all)
+	}
+}
+
+func TestResolveAbs(t *testing.T) {
+	dir, err := ResolveAbs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(dir, "real"), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	symlinkOrSkip(t, filepath.Join(dir, "real"), filepath.Join(dir, "link"))
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join(dir, "real", "..", "real"), filepath.Join(dir, "real")},
+		{filepath.Join(dir, "link"), filepath.Join(dir, "real")},
+		{filepath.Join(dir, "link", "missing.txt"), filepath.Join(dir, "real", "missing.txt")},
+		{filepath.Join(dir, "missing", "file.txt"), filepath.Join(dir, "missing", "file.txt")},
+	}
+	for _, test := range tests {
+		resolved, err := ResolveAbs(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved != test.want {
+			t.Errorf("ResolveAbs(%q) = %q, want %q", test.path, resolved, test.want)
+		}
+	}
+}
+
+func TestResolveAbsSymlinkCycle(t *testing.T) {
+	dir := t.TempDir()
+	symlinkOrSkip(t, filepath.Join(dir, "b"), filepath.Join(dir, "a"))
+	symlinkOrSkip(t, filepath.Join(dir, "a"), filepath.Join(dir, "b"))
+
+	_, err := ResolveAbs(filepath.Join(dir, "a", "file.txt"))
+	if !errors.Is(err, ErrSymlinkCycle) {
+		t.Fatalf("got %v, want ErrSymlinkCycle", err)
+	}
+}
+
+func TestSafeFunctionsRejectSymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip(`Windows collapses ".." before following symlinks`)
+	}
+	dir := useSafetyPath(t)
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "victim.txt")
+	writeTestFile(t, victim, "keep")
+	writeTestFile(t, filepath.Join(outside, "sub", "file.txt"), "keep")
+	link := filepath.Join(dir, "link")
+	symlinkOrSkip(t, filepath.Join(outside, "sub"), link)
+
+	escape := link + string(filepath.Separator) + filepath.Join("..", "victim.txt")
+	calls := map[string]func() error{
+		"DeleteSafeFile":   func() error { return DeleteSafeFile(escape) },
+		"TruncateSafeFile": func() error { return TruncateSafeFile(escape) },
+		"WriteSafeFile":    func() error { return WriteSafeFile(escape, []byte("x"), true) },
+		"DeleteSafeDirectory": func() error {
+			return DeleteSafeDirectory(link + string(filepath.Separator) + "..")
+		},
+	}
+	for name, call := range calls {
+		err := call()
+		if !errors.Is(err, ErrOutsideSafetyPath) {
+			t.Errorf("%s got %v, want ErrOutsideSafetyPath", name, err)
+		}
+	}
+	if readTestFile(t, victim) != "keep" || readTestFile(t, filepath.Join(outside, "sub", "file.txt")) != "keep" {
+		t.Fatal("a file outside the safety path was changed")
+	}
+}
+
+func TestCopyFileBufferedTinyBuffer(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.txt")
+	data := strings.Repeat("0123456789", 100)
+	writeTestFile(t, source, data)
+
+	for _, bufSize := range []int{1, 7, 0} {
+		dest := filepath.Join(dir, "copy.txt")
+		err := CopyFileBuffered(source, dest, bufSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if readTestFile(t, dest) != data {
+			t.Fatalf("copy with a %d byte buffer does not match the source", bufSize)
+		}
+	}
+}
+
+// Records the largest single write. The embedded buffer gives it a ReadFrom method that
+// would bypass a caller's copy buffer if copyStream let it.
+type largestWriteBuffer struct {
+	bytes.Buffer
+	largest int
+}
+
+func (w *largestWriteBuffer) Write(p []byte) (int, error) {
+	if len(p) > w.largest {
+		w.largest = len(p)
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestCopyStreamUsesBuffer(t *testing.T) {
+	data := strings.Repeat("0123456789", 100)
+
+	for _, bufSize := range []int{1, 7, 64} {
+		dst := &largestWriteBuffer{}
+		written, err := copyStream(dst, strings.NewReader(data), make([]byte, bufSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written != int64(len(data)) || dst.String() != data {
+			t.Fatalf("copy with a %d byte buffer does not match the source", bufSize)
+		}
+		if dst.largest > bufSize {
+			t.Errorf("got a %d byte write with a %d byte buffer", dst.largest, bufSize)
+		}
+	}
+}
+
+func BenchmarkCopyFileBuffered(b *testing.B) {
+	dir := b.TempDir()
+	source := filepath.Join(dir, "source.bin")
+	dest := filepath.Join(dir, "copy.bin")
+	err := os.WriteFile(source, []byte(strings.Repeat("x", 8<<20)), 0644)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bufSize := range []int{4 << 10, 32 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("%dKB", bufSize>>10), func(b *testing.B) {
+			b.SetBytes(8 << 20)
+			for i := 0; i < b.N; i++ {
+				err := CopyFileBuffered(source, dest, bufSize)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDatedLogWriterRollover(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 15, 23, 59, 0, 0, time.UTC)
+	t.Cleanup(func() { SetClock(nil) })
+	SetClock(func() time.Time { return now })
+
+	writer, err := OpenDatedLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	_, err = writer.Write([]byte("first day\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, err = writer.Write([]byte("second day\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestFile(t, filepath.Join(dir, "20240115.log")) != "first day\n" {
+		t.Fatal("first day's log has the wrong contents")
+	}
+	if readTestFile(t, filepath.Join(dir, "20240116.log")) != "second day\n" {
+		t.Fatal("writer did not roll over to a new file")
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write([]byte("closed\n"))
+	if err != os.ErrClosed {
+		t.Fatalf("got %v, want os.ErrClosed", err)
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	useClock(t, time.Date(2024, 2, 29, 13, 14, 15, 0, time.UTC))
+
+	if GetDate() != "20240229" {
+		t.Fatalf("got %s, want 20240229", GetDate())
+	}
+	if GetTime() != "13:14:15:00" {
+		t.Fatalf("got %s, want 13:14:15:00", GetTime())
+	}
+
+	SetClock(nil)
+	if clock().IsZero() {
+		t.Fatal("a nil clock did not restore time.Now")
+	}
+}
+
+func TestFindCaseCollisions(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "File.txt"), "upper")
+	writeTestFile(t, filepath.Join(dir, "other.txt"), "other")
+	_, err := os.Stat(filepath.Join(dir, "file.txt"))
+	if err == nil {
+		t.Skip("the filesystem is case-insensitive")
+	}
+	writeTestFile(t, filepath.Join(dir, "file.txt"), "lower")
+
+	collisions, err := FindCaseCollisions(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collisions) != 1 {
+		t.Fatalf("got %v, want a single collision group", collisions)
+	}
+	assertSameItems(t, collisions["file.txt"], []string{filepath.Join(dir, "File.txt"), filepath.Join(dir, "file.txt")})
+}
+
+func TestNewestAndOldestFile(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"middle.txt", "newest.txt", "oldest.txt"} {
+		path := filepath.Join(dir, name)
+		writeTestFile(t, path, name)
+		modTime := base.Add([]time.Duration{time.Hour, 2 * time.Hour, 0}[i])
+		err := os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Subdirectories are ignored even when they are the most recently modified.
+	err := os.Mkdir(filepath.Join(dir, "sub"), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newest, err := NewestFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newest != filepath.Join(dir, "newest.txt") {
+		t.Fatalf("got %s, want newest.txt", newest)
+	}
+	oldest, err := OldestFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldest != filepath.Join(dir, "oldest.txt") {
+		t.Fatalf("got %s, want oldest.txt", oldest)
+	}
+
+	_, err = NewestFile(filepath.Join(dir, "sub"))
+	if !errors.Is(err, ErrNoFiles) {
+		t.Fatalf("got %v, want ErrNoFiles", err)
+	}
+}
+
+func TestChmodRecursive(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permission bits are not supported")
+	}
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir, "sub", "b.txt"), "b")
+
+	err := ChmodRecursive(dir, 0600, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0777) })
+
+	modes := map[string]os.FileMode{
+		dir:                                0700,
+		filepath.Join(dir, "a.txt"):        0600,
+		filepath.Join(dir, "sub"):          0700,
+		filepath.Join(dir, "sub", "b.txt"): 0600,
+	}
+	for path, want := range modes {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s has mode %v, want %v", path, info.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestPruneEmptyDirs(t *testing.T) {
+	dir := useSafetyPath(t)
+	for _, path := range []string{
+		filepath.Join(dir, "empty"),
+		filepath.Join(dir, "nested", "empty", "deeper"),
+		filepath.Join(dir, "kept", "empty"),
+	} {
+		err := os.MkdirAll(path, 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestFile(t, filepath.Join(dir, "kept", "file.txt"), "file")
+
+	removed, err := PruneEmptyDirs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, removed, []string{
+		filepath.Join(dir, "empty"),
+		filepath.Join(dir, "nested"),
+		filepath.Join(dir, "nested", "empty"),
+		filepath.Join(dir, "nested", "empty", "deeper"),
+		filepath.Join(dir, "kept", "empty"),
+	})
+
+	remaining, err := WalkDirContents(dir, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, remaining, []string{"kept", filepath.Join("kept", "file.txt")})
+}
+
+func TestPruneEmptyDirsOutside(t *testing.T) {
+	useSafetyPath(t)
+	outside := t.TempDir()
+	err := os.Mkdir(filepath.Join(outside, "empty"), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = PruneEmptyDirs(outside)
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("got %v, want ErrOutsideSafetyPath", err)
+	}
+}
+
+func TestJSONLinesWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+
+	writer, err := NewJSONLinesWriter(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, config := range []testConfig{{Name: "a", Retries: 1}, {Name: "b", Retries: 2}} {
+		err := writer.Write(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err = NewJSONLinesWriter(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Write(testConfig{Name: "c", Retries: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := ReadLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+	for i, name := range []string{"a", "b", "c"} {
+		var config testConfig
+		err := json.Unmarshal([]byte(lines[i]), &config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Name != name || config.Retries != i+1 {
+			t.Errorf("line %d got %+v", i, config)
+		}
+	}
+}
+
+func TestFilesEqualText(t *testing.T) {
+	dir := t.TempDir()
+	lf := filepath.Join(dir, "lf.txt")
+	crlf := filepath.Join(dir, "crlf.txt")
+	other := filepath.Join(dir, "other.txt")
+	longer := filepath.Join(dir, "longer.txt")
+	writeTestFile(t, lf, "one\ntwo\n")
+	writeTestFile(t, crlf, "one\r\ntwo\r\n")
+	writeTestFile(t, other, "one\ntoo\n")
+	writeTestFile(t, longer, "one\ntwo\nthree\n")
+
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{lf, crlf, true},
+		{lf, other, false},
+		{lf, longer, false},
+	}
+	for _, test := range tests {
+		equal, err := FilesEqualText(test.a, test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if equal != test.want {
+			t.Errorf("FilesEqualText(%s, %s) = %v, want %v", filepath.Base(test.a), filepath.Base(test.b), equal, test.want)
+		}
+	}
+}
+
+func TestCreateFileAll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "data", "file.json")
+
+	err := CreateFileAll(path, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, path) != "{}" {
+		t.Fatal("file has the wrong contents")
+	}
+}
+
+func TestJoinSafe(t *testing.T) {
+	base := t.TempDir()
+
+	joined, err := JoinSafe(base, "a", "b", "..", "c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joined != filepath.Join(base, "a", "c.txt") {
+		t.Fatalf("got %s, want %s", joined, filepath.Join(base, "a", "c.txt"))
+	}
+
+	for _, parts := range [][]string{{".."}, {"a", "..", "..", "escape"}, {"../" + filepath.Base(base) + "-other"}} {
+		_, err := JoinSafe(base, parts...)
+		if !errors.Is(err, ErrPathEscapes) {
+			t.Errorf("JoinSafe(%v) got %v, want ErrPathEscapes", parts, err)
+		}
+	}
+}
+
+func TestPeekFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	writeTestFile(t, path, "0123456789")
+
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{4, "0123"},
+		{10, "0123456789"},
+		{100, "0123456789"},
+		{0, ""},
+		{-1, ""},
+		{1 << 62, "0123456789"},
+	}
+	for _, test := range tests {
+		data, err := PeekFile(path, test.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.want {
+			t.Errorf("PeekFile(%d) = %q, want %q", test.n, data, test.want)
+		}
+	}
+}
+
+func TestDetectContentType(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"image.dat": "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"notes.dat": "plain text notes\n",
+		"empty.dat": "",
+	}
+	want := map[string]string{
+		"image.dat": "image/png",
+		"notes.dat": "text/plain; charset=utf-8",
+		"empty.dat": "text/plain; charset=utf-8",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		writeTestFile(t, path, data)
+
+		contentType, err := DetectContentType(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != want[name] {
+			t.Errorf("DetectContentType(%s) = %s, want %s", name, contentType, want[name])
+		}
+	}
+}
+
+func TestCopyFolderContentsConflicts(t *testing.T) {
+	source := t.TempDir()
+	writeTestFile(t, filepath.Join(source, "new.txt"), "new")
+	writeTestFile(t, filepath.Join(source, "sub", "shared.txt"), "source")
+
+	// Returns a destination already holding an older copy of the shared file.
+	prepared := func() string {
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(dest, "sub", "shared.txt"), "dest")
+		return dest
+	}
+
+	dest := prepared()
+	err := CopyFolderContentsWithOptions(source, dest, CopyOptions{Conflicts: Overwrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, filepath.Join(dest, "sub", "shared.txt")) != "source" || readTestFile(t, filepath.Join(dest, "new.txt")) != "new" {
+		t.Fatal("Overwrite did not replace the existing file")
+	}
+
+	dest = prepared()
+	err = CopyFolderContentsWithOptions(source, dest, CopyOptions{Conflicts: SkipExisting})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, filepath.Join(dest, "sub", "shared.txt")) != "dest" || readTestFile(t, filepath.Join(dest, "new.txt")) != "new" {
+		t.Fatal("SkipExisting replaced the existing file or skipped a new one")
+	}
+
+	dest = prepared()
+	err = CopyFolderContentsWithOptions(source, dest, CopyOptions{Conflicts: FailOnConflict})
+	if !errors.Is(err, ErrDestExists) {
+		t.Fatalf("got %v, want ErrDestExists", err)
+	}
+	if !strings.Contains(err.Error(), filepath.Join("sub", "shared.txt")) {
+		t.Fatalf("error %q does not name the conflicting path", err)
+	}
+	exists, err := FileExists(filepath.Join(dest, "new.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("FailOnConflict copied files before failing")
+	}
+}
+
+func TestCopyFolderContentsSymlinkConflicts(t *testing.T) {
+	source := t.TempDir()
+	writeTestFile(t, filepath.Join(source, "new.txt"), "new")
+	symlinkOrSkip(t, filepath.Join(source, "new.txt"), filepath.Join(source, "link"))
+	opts := CopyOptions{Symlinks: SymlinkCopy}
+
+	// Returns a destination already holding a dangling link with the same name.
+	prepared := func() string {
+		dest := t.TempDir()
+		symlinkOrSkip(t, filepath.Join(dest, "missing.txt"), filepath.Join(dest, "link"))
+		return dest
+	}
+
+	dest := prepared()
+	opts.Conflicts = Overwrite
+	err := CopyFolderContentsWithOptions(source, dest, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := os.Readlink(filepath.Join(dest, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != filepath.Join(source, "new.txt") {
+		t.Fatalf("Overwrite left the link pointing to %s", target)
+	}
+
+	dest = prepared()
+	opts.Conflicts = SkipExisting
+	err = CopyFolderContentsWithOptions(source, dest, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err = os.Readlink(filepath.Join(dest, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != filepath.Join(dest, "missing.txt") {
+		t.Fatalf("SkipExisting replaced the existing link with one to %s", target)
+	}
+
+	dest = prepared()
+	opts.Conflicts = FailOnConflict
+	err = CopyFolderContentsWithOptions(source, dest, opts)
+	if !errors.Is(err, ErrDestExists) {
+		t.Fatalf("got %v, want ErrDestExists", err)
+	}
+	exists, err := FileExists(filepath.Join(dest, "new.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("FailOnConflict copied files before failing")
+	}
+}
+
+func TestMoveDirectoryMergeSymlinks(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	dest := filepath.Join(root, "dest")
+	writeTestFile(t, filepath.Join(source, "a.txt"), "new")
+	writeTestFile(t, filepath.Join(dest, "a.txt"), "old")
+	symlinkOrSkip(t, "a.txt", filepath.Join(source, "link"))
+	symlinkOrSkip(t, "b.txt", filepath.Join(dest, "link"))
+
+	err := MoveDirectory(source, dest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := os.Readlink(filepath.Join(dest, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "a.txt" || readTestFile(t, filepath.Join(dest, "a.txt")) != "new" {
+		t.Fatal("merge did not replace the existing file and link")
+	}
+	_, err = os.Stat(source)
+	if !os.IsNotExist(err) {
+		t.Fatalf("source still exists after the merge: %v", err)
+	}
+}
+
+func TestListFunctionsReturnNilOnError(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	calls := map[string]func() ([]string, error){
+		"GetDirContents":         func() ([]string, error) { return GetDirContents(missing, true) },
+		"GetDirContentsFiltered": func() ([]string, error) { return GetDirContentsFiltered(missing, true, ListOptions{}) },
+		"GetDirContentsByExt":    func() ([]string, error) { return GetDirContentsByExt(missing, true, "txt") },
+		"GetDirContentsVisible":  func() ([]string, error) { return GetDirContentsVisible(missing, true) },
+		"GetSubdirectories":      func() ([]string, error) { return GetSubdirectories(missing, true) },
+		"WalkDirContents":        func() ([]string, error) { return WalkDirContents(missing, true, true) },
+		"GetDirContentsRelative": func() ([]string, error) { return GetDirContentsRelative(missing) },
+		"GetDirContentsDepth":    func() ([]string, error) { return GetDirContentsDepth(missing, true, -1) },
+		"FindFiles":              func() ([]string, error) { return FindFiles(missing, "*") },
+		"ReadLines":              func() ([]string, error) { return ReadLines(missing) },
+	}
+	for name, call := range calls {
+		contents, err := call()
+		if err == nil {
+			t.Errorf("%s returned no error for a missing path", name)
+		}
+		if contents != nil {
+			t.Errorf("%s returned %#v alongside an error, want nil", name, contents)
+		}
+	}
+}
+
+func TestWriteFileWithBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	err := WriteFileWithBackup(path, []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WriteFileWithBackup(path, []byte("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, path) != "second" || readTestFile(t, path+".bak") != "first" {
+		t.Fatal("file or backup has the wrong contents")
+	}
+}
+
+func TestWriteFileWithBackupRestores(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, path, "original")
+
+	// Truncate the file before failing, as a crash or full disk would.
+	writeErr := errors.New("disk full")
+	previous := writeFile
+	t.Cleanup(func() { writeFile = previous })
+	writeFile = func(name string, data []byte, perm os.FileMode) error {
+		os.WriteFile(name, data[:1], perm)
+		return writeErr
+	}
+
+	err := WriteFileWithBackup(path, []byte("replacement"))
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("got %v, want the injected write error", err)
+	}
+	if readTestFile(t, path) != "original" {
+		t.Fatalf("file was not restored, got %q", readTestFile(t, path))
+	}
+}
+
+func TestSymlinkHelpers(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	link := filepath.Join(dir, "link.txt")
+	writeTestFile(t, target, "target")
+
+	err := CreateSymlink(target, link)
+	if err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+
+	read, err := ReadSymlink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != target {
+		t.Fatalf("got %s, want %s", read, target)
+	}
+
+	isLink, err := IsSymlink(link)
+	if err != nil || !isLink {
+		t.Fatalf("got %v, %v for a symlink", isLink, err)
+	}
+	isLink, err = IsSymlink(target)
+	if err != nil || isLink {
+		t.Fatalf("got %v, %v for a regular file", isLink, err)
+	}
+	_, err = IsSymlink(filepath.Join(dir, "missing"))
+	if err == nil {
+		t.Fatal("expected an error for a missing path")
+	}
+	_, err = ReadSymlink(target)
+	if err == nil {
+		t.Fatal("expected an error reading a regular file as a symlink")
+	}
+}
+
+func TestFlattenDirectory(t *testing.T) {
+	source := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "flat")
+	writeTestFile(t, filepath.Join(source, "top.txt"), "top")
+	writeTestFile(t, filepath.Join(source, "sub", "dir", "file.txt"), "nested")
+
+	err := FlattenDirectory(source, dest, "_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := GetDirContents(dest, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, contents, []string{"top.txt", "sub_dir_file.txt"})
+	if readTestFile(t, filepath.Join(dest, "sub_dir_file.txt")) != "nested" {
+		t.Fatal("flattened file has the wrong contents")
+	}
+}
+
+func TestFlattenDirectoryCollision(t *testing.T) {
+	source := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "flat")
+	writeTestFile(t, filepath.Join(source, "a_b.txt"), "one")
+	writeTestFile(t, filepath.Join(source, "a", "b.txt"), "two")
+
+	err := FlattenDirectory(source, dest, "_")
+	if !errors.Is(err, ErrDestExists) {
+		t.Fatalf("got %v, want ErrDestExists", err)
+	}
+	exists, err := DirExists(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("files were copied before the collision was reported")
+	}
+}
+
+func TestGetDirContentsVisible(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, ".gitignore"), "*.tmp")
+	writeTestFile(t, filepath.Join(dir, "main.go"), "package main")
+	writeTestFile(t, filepath.Join(dir, ".git", "HEAD"), "ref")
+
+	visible, err := GetDirContentsVisible(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, visible, []string{"main.go"})
+
+	full, err := GetDirContentsVisible(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, full, []string{filepath.Join(dir, "main.go")})
+}
+
+func TestWithRetryStopsOnPermanentError(t *testing.T) {
+	permanent := errors.New("permanent")
+	calls := 0
+
+	err := WithRetry(5, time.Millisecond, func() error {
+		calls++
+		return permanent
+	})
+	if !errors.Is(err, permanent) || calls != 1 {
+		t.Fatalf("got %v after %d calls, want the permanent error after 1", err, calls)
+	}
+
+	calls = 0
+	err = WithRetry(0, time.Millisecond, func() error {
+		calls++
+		return nil
+	})
+	if err != nil || calls != 1 {
+		t.Fatalf("got %v after %d calls, want success after 1", err, calls)
+	}
+}
+
+func TestCopyFileVerified(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.txt")
+	dest := filepath.Join(dir, "dest.txt")
+	writeTestFile(t, source, "verified")
+
+	err := CopyFileVerified(source, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, dest) != "verified" {
+		t.Fatal("copy has the wrong contents")
+	}
+}
+
+func TestCopyFileVerifiedMismatch(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.txt")
+	dest := filepath.Join(dir, "dest.txt")
+	writeTestFile(t, source, "verified")
+
+	// Report a different hash for the copy, as silent corruption would.
+	previous := verifyHash
+	t.Cleanup(func() { verifyHash = previous })
+	verifyHash = func(path string, algo string) (string, error) {
+		if path == dest {
+			return "corrupt", nil
+		}
+		return previous(path, algo)
+	}
+
+	err := CopyFileVerified(source, dest)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("got %v, want ErrChecksumMismatch", err)
+	}
+	_, err = os.Stat(dest)
+	if !os.IsNotExist(err) {
+		t.Fatal("mismatched copy was not removed")
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "same.txt"), "same")
+	writeTestFile(t, filepath.Join(dir, "changed.txt"), "before")
+	writeTestFile(t, filepath.Join(dir, "sub", "removed.txt"), "removed")
+
+	oldSnap, err := TakeSnapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Snapshots are serializable, so compare against one that went through json.
+	data, err := json.Marshal(oldSnap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored Snapshot
+	err = json.Unmarshal(data, &restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "changed.txt"), "after!")
+	later := time.Now().Add(time.Hour)
+	err = os.Chtimes(filepath.Join(dir, "changed.txt"), later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(filepath.Join(dir, "sub", "removed.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "sub", "added.txt"), "added")
+
+	newSnap, err := TakeSnapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, removed, modified := DiffSnapshots(restored, newSnap)
+	if len(added) != 1 || added[0] != "sub/added.txt" {
+		t.Errorf("got added %v, want [sub/added.txt]", added)
+	}
+	if len(removed) != 1 || removed[0] != "sub/removed.txt" {
+		t.Errorf("got removed %v, want [sub/removed.txt]", removed)
+	}
+	if len(modified) != 1 || modified[0] != "changed.txt" {
+		t.Errorf("got modified %v, want [changed.txt]", modified)
+	}
+}
+
+func TestEmptySafeDirectory(t *testing.T) {
+	dir := useSafetyPath(t)
+	target := filepath.Join(dir, "target")
+	writeTestFile(t, filepath.Join(target, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(target, "sub", "b.txt"), "b")
+	err := os.Chmod(target, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = EmptySafeDirectory(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := IsDirEmpty(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !empty {
+		t.Fatal("directory still has children")
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0750 {
+		t.Fatalf("directory mode changed to %v", info.Mode().Perm())
+	}
+}
+
+func TestEmptySafeDirectoryOutside(t *testing.T) {
+	useSafetyPath(t)
+	outside := t.TempDir()
+	writeTestFile(t, filepath.Join(outside, "keep.txt"), "keep")
+
+	err := EmptySafeDirectory(outside)
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("got %v, want ErrOutsideSafetyPath", err)
+	}
+	if readTestFile(t, filepath.Join(outside, "keep.txt")) != "keep" {
+		t.Fatal("directory outside the safety path was emptied")
+	}
+}
+
+// Replaces the logger with one that records each operation name, restoring the no-op
+// logger when the test ends.
+func captureOperations(t *testing.T) func() []string {
+	t.Helper()
+	var mu sync.Mutex
+	var ops []string
+	t.Cleanup(func() { SetLogger(nil) })
+	SetLogger(func(op string, path string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		ops = append(ops, op)
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ops...)
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	dir := useSafetyPath(t)
+	source := filepath.Join(dir, "source.txt")
+	writeTestFile(t, source, "data")
+	tree := filepath.Join(dir, "tree")
+	writeTestFile(t, filepath.Join(tree, "file.txt"), "data")
+	ops := captureOperations(t)
+
+	steps := []func() error{
+		func() error { return CopyFile(source, filepath.Join(dir, "copy.txt")) },
+		func() error { return CopyFileProgress(source, filepath.Join(dir, "progress.txt"), nil) },
+		func() error { return CopyFolderContents(tree, filepath.Join(dir, "folder")) },
+		func() error { return CopyFolderContentsParallel(tree, filepath.Join(dir, "parallel"), 2) },
+		func() error { return MirrorDirectory(tree, filepath.Join(dir, "mirror")) },
+		func() error { return WriteFileWithBackup(source, []byte("new")) },
+		func() error { return DeleteSafeFile(filepath.Join(dir, "copy.txt")) },
+		func() error {
+			_, err := PruneEmptyDirs(dir)
+			return err
+		},
+		func() error { return EmptyTrash() },
+	}
+	for _, step := range steps {
+		err := step()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"CopyFile",
+		"CopyFileProgress",
+		"CopyFolderContents",
+		"CopyFolderContentsParallel",
+		"MirrorDirectory",
+		"WriteFileWithBackup",
+		"DeleteSafeFile",
+		"PruneEmptyDirs",
+		"EmptyTrash",
+	}
+	logged := make(map[string]bool)
+	for _, op := range ops() {
+		logged[op] = true
+	}
+	for _, op := range want {
+		if !logged[op] {
+			t.Errorf("no %s event was logged", op)
+		}
+	}
+}
+
+func TestSetLoggerReportsErrors(t *testing.T) {
+	var gotOp string
+	var gotErr error
+	t.Cleanup(func() { SetLogger(nil) })
+	SetLogger(func(op string, path string, err error) {
+		gotOp, gotErr = op, err
+	})
+
+	err := CopyFile(filepath.Join(t.TempDir(), "missing.txt"), filepath.Join(t.TempDir(), "copy.txt"))
+	if err == nil {
+		t.Fatal("expected an error copying a missing file")
+	}
+	if gotOp != "CopyFile" || gotErr != err {
+		t.Fatalf("logged %s with %v, want CopyFile with %v", gotOp, gotErr, err)
+	}
+}
+
+func TestPathDepth(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "base")
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{base, 0},
+		{filepath.Join(base, "a"), 1},
+		{filepath.Join(base, "a", "b", "c"), 3},
+		{filepath.Dir(base), -1},
+		{filepath.Dir(filepath.Dir(base)), -2},
+	}
+	for _, test := range tests {
+		depth, err := PathDepth(base, test.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if depth != test.want {
+			t.Errorf("PathDepth(%s) = %d, want %d", test.target, depth, test.want)
+		}
+	}
+
+	_, err := PathDepth(base, filepath.Join(filepath.Dir(base), "sibling"))
+	if err == nil {
+		t.Fatal("expected an error for a sibling path")
+	}
+}
+
+func TestOpenForWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "dir", "file.txt")
+
+	file, err := OpenForWrite(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteString("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	_, err = OpenForWrite(path, false)
+	if !errors.Is(err, ErrDestExists) {
+		t.Fatalf("got %v, want ErrDestExists", err)
+	}
+
+	file, err = OpenForWrite(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteString("2nd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	if readTestFile(t, path) != "2nd" {
+		t.Fatalf("got %q, want the file truncated and rewritten", readTestFile(t, path))
+	}
+}
+
+func TestExportOrderedToJson(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ordered.json")
+	data := map[string]interface{}{"zeta": 1, "alpha": "a", "mid": []int{1, 2}}
+
+	err := ExportOrderedToJson(path, []string{"zeta", "alpha", "mid"}, data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, path) != `{"zeta":1,"alpha":"a","mid":[1,2]}` {
+		t.Fatalf("got %s, want keys in the requested order", readTestFile(t, path))
+	}
+
+	badKeys := [][]string{
+		{"zeta", "alpha"},
+		{"zeta", "alpha", "mid", "extra"},
+		{"zeta", "alpha", "mid", "zeta"},
+	}
+	for _, keys := range badKeys {
+		err := ExportOrderedToJson(filepath.Join(dir, "bad.json"), keys, data, true)
+		if err == nil {
+			t.Errorf("keys %v should have been rejected", keys)
+		}
+	}
+}
+
+func TestWalkSkipDir(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir, "skip", "hidden.txt"), "hidden")
+	writeTestFile(t, filepath.Join(dir, "keep", "b.txt"), "b")
+
+	var visited []string
+	err := Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == "skip" {
+			return SkipDir
+		}
+		visited = append(visited, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, visited, []string{
+		dir,
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "keep"),
+		filepath.Join(dir, "keep", "b.txt"),
+	})
+}
+
+func TestDeleteSafeFileReadOnly(t *testing.T) {
+	dir := useSafetyPath(t)
+	path := filepath.Join(dir, "readonly.txt")
+	writeTestFile(t, path, "locked")
+	err := os.Chmod(path, 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unix only checks the directory's permissions, so read-only files delete either way.
+	err = DeleteSafeFile(path)
+	if err == nil {
+		t.Skip("read-only files can be deleted without SetDeleteReadOnly on this platform")
+	}
+	t.Cleanup(func() { SetDeleteReadOnly(false) })
+	SetDeleteReadOnly(true)
+
+	err = DeleteSafeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(path)
+	if !os.IsNotExist(err) {
+		t.Fatal("read-only file was not deleted")
+	}
+}
+
+func TestDeleteSafeDirectoryReadOnly(t *testing.T) {
+	dir := useSafetyPath(t)
+	target := filepath.Join(dir, "target")
+	writeTestFile(t, filepath.Join(target, "sub", "readonly.txt"), "locked")
+	for _, path := range []string{filepath.Join(target, "sub", "readonly.txt"), filepath.Join(target, "sub")} {
+		err := os.Chmod(path, 0555)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(target, "sub"), 0777) })
+	t.Cleanup(func() { SetDeleteReadOnly(false) })
+	SetDeleteReadOnly(true)
+
+	err := DeleteSafeDirectory(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(target)
+	if !os.IsNotExist(err) {
+		t.Fatal("directory with read-only entries was not deleted")
+	}
+}
+
+func TestIterDir(t *testing.T) {
+	dir := t.TempDir()
+	var want []string
+	// More entries than a single batch so IterDir has to read from disk more than once.
+	for i := 0; i < iterDirBatchSize+10; i++ {
+		name := fmt.Sprintf("file%03d.txt", i)
+		writeTestFile(t, filepath.Join(dir, name), "")
+		want = append(want, name)
+	}
+
+	next, err := IterDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		name, ok, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, name)
+	}
+	assertSameItems(t, got, want)
+
+	_, ok, err := next()
+	if ok || err != nil {
+		t.Fatalf("exhausted iterator returned %v, %v", ok, err)
+	}
+}
+
+func TestIterDirPartialBatchError(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir, "b.txt"), "b")
+	readFailed := errors.New("read failed")
+
+	// The first read returns every entry along with an error, any further read is a bug.
+	previous := readDirBatch
+	t.Cleanup(func() { readDirBatch = previous })
+	calls := 0
+	readDirBatch = func(file *os.File, n int) ([]fs.DirEntry, error) {
+		calls++
+		if calls > 1 {
+			t.Fatal("ReadDir was called again after returning an error")
+		}
+		entries, err := previous(file, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries, readFailed
+	}
+
+	next, err := IterDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		name, ok, err := next()
+		if err != nil {
+			if !errors.Is(err, readFailed) {
+				t.Fatalf("got %v, want the read error", err)
+			}
+			break
+		}
+		if !ok {
+			t.Fatal("iterator finished without returning the read error")
+		}
+		got = append(got, name)
+	}
+	assertSameItems(t, got, []string{"a.txt", "b.txt"})
+}
+
+func TestIterDirMissing(t *testing.T) {
+	_, err := IterDir(filepath.Join(t.TempDir(), "missing"))
+	if err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+}
+
+func TestCopyNewerThan(t *testing.T) {
+	source := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "dest")
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	files := map[string]time.Time{
+		"old.txt":                       cutoff.Add(-time.Hour),
+		"new.txt":                       cutoff.Add(time.Hour),
+		filepath.Join("sub", "new.txt"): cutoff.Add(time.Minute),
+		filepath.Join("sub", "old.txt"): cutoff,
+	}
+	for name, modTime := range files {
+		path := filepath.Join(source, name)
+		writeTestFile(t, path, name)
+		err := os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	copied, err := CopyNewerThan(source, dest, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, copied, []string{"new.txt", filepath.Join("sub", "new.txt")})
+
+	copiedFiles, err := WalkDirContents(dest, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, copiedFiles, copied)
+	if readTestFile(t, filepath.Join(dest, "sub", "new.txt")) != filepath.Join("sub", "new.txt") {
+		t.Fatal("copied file has the wrong contents")
+	}
+}
+
+func TestRenameFilesByPattern(t *testing.T) {
+	dir := useSafetyPath(t)
+	writeTestFile(t, filepath.Join(dir, "draft_intro.md"), "intro")
+	writeTestFile(t, filepath.Join(dir, "chapters", "draft_one.md"), "one")
+	writeTestFile(t, filepath.Join(dir, "chapters", "notes.md"), "notes")
+
+	renamed, err := RenameFilesByPattern(dir, "draft_", "final_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, renamed, []string{
+		filepath.Join(dir, "final_intro.md"),
+		filepath.Join(dir, "chapters", "final_one.md"),
+	})
+	files, err := WalkDirContents(dir, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, files, []string{
+		"final_intro.md",
+		filepath.Join("chapters", "final_one.md"),
+		filepath.Join("chapters", "notes.md"),
+	})
+}
+
+func TestRenameFilesByPatternCollision(t *testing.T) {
+	dir := useSafetyPath(t)
+	writeTestFile(t, filepath.Join(dir, "draft_a.md"), "draft")
+	writeTestFile(t, filepath.Join(dir, "final_a.md"), "final")
+	writeTestFile(t, filepath.Join(dir, "draft_b.md"), "b")
+
+	_, err := RenameFilesByPattern(dir, "draft_", "final_")
+	if !errors.Is(err, ErrDestExists) {
+		t.Fatalf("got %v, want ErrDestExists", err)
+	}
+	if readTestFile(t, filepath.Join(dir, "draft_b.md")) != "b" || readTestFile(t, filepath.Join(dir, "final_a.md")) != "final" {
+		t.Fatal("files were renamed before the collision was reported")
+	}
+}
+
+func TestRenameFilesByPatternEscape(t *testing.T) {
+	dir := useSafetyPath(t)
+	writeTestFile(t, filepath.Join(dir, "x.txt"), "x")
+
+	for _, replace := range []string{"../../escaped", "sub" + string(filepath.Separator) + "x", "..", "a/b"} {
+		_, err := RenameFilesByPattern(dir, "x", replace)
+		if err == nil {
+			t.Errorf("replace %q was accepted", replace)
+		}
+	}
+	if readTestFile(t, filepath.Join(dir, "x.txt")) != "x" {
+		t.Fatal("a rejected rename moved the file")
+	}
+
+	_, err := RenameFilesByPattern(t.TempDir(), "x", "y")
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("got %v, want ErrOutsideSafetyPath", err)
+	}
+}
+
+func TestCommonParent(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a", "b", "one.txt"), "one")
+	writeTestFile(t, filepath.Join(dir, "a", "b", "two.txt"), "two")
+	writeTestFile(t, filepath.Join(dir, "a", "c", "three.txt"), "three")
+	writeTestFile(t, filepath.Join(dir, "ab", "four.txt"), "four")
+
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{filepath.Join(dir, "a", "b", "one.txt")}, filepath.Join(dir, "a", "b")},
+		{[]string{filepath.Join(dir, "a", "b", "one.txt"), filepath.Join(dir, "a", "b", "two.txt")}, filepath.Join(dir, "a", "b")},
+		{[]string{filepath.Join(dir, "a", "b", "one.txt"), filepath.Join(dir, "a", "c", "three.txt")}, filepath.Join(dir, "a")},
+		{[]string{filepath.Join(dir, "a", "b"), filepath.Join(dir, "a", "b", "one.txt")}, filepath.Join(dir, "a", "b")},
+		// Shared name prefixes are not a shared directory.
+		{[]string{filepath.Join(dir, "a", "b", "one.txt"), filepath.Join(dir, "ab", "four.txt")}, dir},
+	}
+	for _, test := range tests {
+		// The result does not depend on the order of the paths.
+		for _, paths := range [][]string{test.paths, reversed(test.paths)} {
+			parent, err := CommonParent(paths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parent != test.want {
+				t.Errorf("CommonParent(%v) = %s, want %s", paths, parent, test.want)
+			}
+		}
+	}
+
+	// Paths with nothing else in common still share the root of the volume.
+	root := filepath.VolumeName(dir) + string(filepath.Separator)
+	parent, err := CommonParent([]string{filepath.Join(dir, "a"), filepath.Join(root, "other", "file.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent != root {
+		t.Fatalf("got %s for disjoint paths, want %s", parent, root)
+	}
+
+	_, err = CommonParent(nil)
+	if err == nil {
+		t.Fatal("expected an error for no paths")
+	}
+}
+
+// Returns a reversed copy of a slice.
+func reversed(values []string) []string {
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[len(values)-1-i] = value
+	}
+	return result
+}
+
+func TestTarGzRoundTrip(t *testing.T) {
+	source := t.TempDir()
+	writeTestFile(t, filepath.Join(source, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(source, "sub", "b.sh"), "#!/bin/sh")
+	err := os.Chmod(filepath.Join(source, "sub", "b.sh"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chmod(filepath.Join(source, "a.txt"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The archive lives inside the tree it archives and must not include itself.
+	archive := filepath.Join(source, "backup.tar.gz")
+	err = TarGzDirectory(source, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	err = UntarGz(archive, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := WalkDirContents(dest, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, files, []string{"a.txt", filepath.Join("sub", "b.sh")})
+	if readTestFile(t, filepath.Join(dest, "sub", "b.sh")) != "#!/bin/sh" {
+		t.Fatal("extracted file has the wrong contents")
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	modes := map[string]os.FileMode{"a.txt": 0600, filepath.Join("sub", "b.sh"): 0755}
+	for name, want := range modes {
+		info, err := os.Stat(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s has mode %v, want %v", name, info.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestUntarGzRejectsEscape(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "evil.tar.gz")
+	file, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	data := []byte("escaped")
+	err = tarWriter.WriteHeader(&tar.Header{Name: "../evil.txt", Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tarWriter.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+	file.Close()
+
+	dest := filepath.Join(dir, "dest")
+	err = UntarGz(archive, dest)
+	if !errors.Is(err, ErrPathEscapes) {
+		t.Fatalf("got %v, want ErrPathEscapes", err)
+	}
+	_, err = os.Stat(filepath.Join(dir, "evil.txt"))
+	if !os.IsNotExist(err) {
+		t.Fatal("entry was extracted outside the destination")
+	}
+}
+
+func TestTarGzDirectoryRemovesFailedArchive(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("requires unix file permissions as a non-root user")
+	}
+	source := t.TempDir()
+	writeTestFile(t, filepath.Join(source, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(source, "locked.txt"), "locked")
+	err := os.Chmod(filepath.Join(source, "locked.txt"), 0000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "backup.tar.gz")
+	err = TarGzDirectory(source, archive)
+	if err == nil {
+		t.Fatal("expected an error archiving an unreadable file")
+	}
+	_, err = os.Stat(archive)
+	if !os.IsNotExist(err) {
+		t.Fatal("partial archive was not removed")
+	}
+}
+
+func TestImportJsonOrDefault(t *testing.T) {
+	dir := t.TempDir()
+	def := testConfig{Name: "default", Retries: 3}
+
+	config, err := ImportJsonOrDefault(filepath.Join(dir, "missing.json"), def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Name != "default" || config.Retries != 3 {
+		t.Fatalf("got %+v, want the default", config)
+	}
+
+	path := filepath.Join(dir, "config.json")
+	writeTestFile(t, path, `{"name":"saved","retries":5}`)
+	config, err = ImportJsonOrDefault(path, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Name != "saved" || config.Retries != 5 {
+		t.Fatalf("got %+v, want the saved config", config)
+	}
+
+	writeTestFile(t, path, `{"name":`)
+	_, err = ImportJsonOrDefault(path, def)
+	if !errors.Is(err, ErrInvalidJson) {
+		t.Fatalf("got %v, want ErrInvalidJson", err)
+	}
+}
+
+func TestDeleteSafeDirectoryBestEffort(t *testing.T) {
+	dir := useSafetyPath(t)
+	target := filepath.Join(dir, "target")
+	writeTestFile(t, filepath.Join(target, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(target, "sub", "b.txt"), "b")
+
+	failures, err := DeleteSafeDirectoryBestEffort(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 0 {
+		t.Fatalf("got failures %v, want none", failures)
+	}
+	_, err = os.Stat(target)
+	if !os.IsNotExist(err) {
+		t.Fatal("directory was not deleted")
+	}
+}
+
+func TestDeleteSafeDirectoryBestEffortPermission(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("requires unix file permissions as a non-root user")
+	}
+	dir := useSafetyPath(t)
+	target := filepath.Join(dir, "target")
+	locked := filepath.Join(target, "locked")
+	writeTestFile(t, filepath.Join(target, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(target, "open", "b.txt"), "b")
+	writeTestFile(t, filepath.Join(locked, "c.txt"), "c")
+	err := os.Chmod(locked, 0500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0777) })
+
+	failures, err := DeleteSafeDirectoryBestEffort(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) == 0 {
+		t.Fatal("expected failures for the locked directory")
+	}
+	for _, path := range []string{filepath.Join(target, "a.txt"), filepath.Join(target, "open")} {
+		_, err = os.Stat(path)
+		if !os.IsNotExist(err) {
+			t.Errorf("%s was not deleted", path)
+		}
+	}
+	if readTestFile(t, filepath.Join(locked, "c.txt")) != "c" {
+		t.Fatal("file in the locked directory should have survived")
+	}
+}
+
+func TestDeleteSafeDirectoryBestEffortOutside(t *testing.T) {
+	useSafetyPath(t)
+	outside := t.TempDir()
+	writeTestFile(t, filepath.Join(outside, "keep.txt"), "keep")
+
+	_, err := DeleteSafeDirectoryBestEffort(outside)
+	if !errors.Is(err, ErrOutsideSafetyPath) {
+		t.Fatalf("got %v, want ErrOutsideSafetyPath", err)
+	}
+	if readTestFile(t, filepath.Join(outside, "keep.txt")) != "keep" {
+		t.Fatal("directory outside the safety path was modified")
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "same")
+	writeTestFile(t, filepath.Join(dir, "sub", "b.txt"), "same")
+	writeTestFile(t, filepath.Join(dir, "c.txt"), "diff")
+	writeTestFile(t, filepath.Join(dir, "d.txt"), "longer contents")
+
+	groups, err := FindDuplicates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, want 1", len(groups))
+	}
+	hash, err := HashFile(filepath.Join(dir, "a.txt"), "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, groups[hash], []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "b.txt")})
+}
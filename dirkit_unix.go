@@ -0,0 +1,49 @@
+//go:build unix
+
+package dirkit
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// The line ending written by functions such as WriteLines.
+const lineEnding = "\n"
+
+// Helper function for determining if an error came from moving across devices.
+// Args:
+//
+//	err(error): The error returned from os.Rename.
+//
+// Returns:
+//
+//	bool: True if the error is a cross-device link error else false.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// Helper function for determining if a file has an OS hidden attribute. Unix
+// systems have no such attribute, hidden files are only marked by a leading dot.
+// Args:
+//
+//	info(fs.FileInfo): The info of the file to check.
+//
+// Returns:
+//
+//	bool: Always false.
+func hasHiddenAttribute(info fs.FileInfo) bool {
+	return false
+}
+
+// Helper function for determining if an error is transient and worth retrying.
+// Args:
+//
+//	err(error): The error to check.
+//
+// Returns:
+//
+//	bool: True if the error is EBUSY, EAGAIN, or EINTR else false.
+func isRetryableError(err error) bool {
+	return errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR)
+}
@@ -0,0 +1,193 @@
+//go:build unix
+
+package dirkit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithRetryRetriesTransientErrors(t *testing.T) {
+	busy := &os.PathError{Op: "remove", Path: "file.txt", Err: syscall.EBUSY}
+	calls := 0
+
+	err := WithRetry(5, time.Millisecond, func() error {
+		calls++
+		if calls < 3 {
+			return busy
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("got %v after %d calls, want success after 3", err, calls)
+	}
+
+	calls = 0
+	err = WithRetry(2, time.Millisecond, func() error {
+		calls++
+		return busy
+	})
+	if !errors.Is(err, syscall.EBUSY) || calls != 2 {
+		t.Fatalf("got %v after %d calls, want EBUSY after 2", err, calls)
+	}
+}
+
+// Makes every rename fail as if source and dest were on different devices, restoring
+// os.Rename when the test ends.
+func useCrossDeviceRename(t *testing.T) {
+	t.Helper()
+	previous := rename
+	t.Cleanup(func() { rename = previous })
+	rename = func(oldPath string, newPath string) error {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.EXDEV}
+	}
+}
+
+func TestMoveFileCrossDevice(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.txt")
+	dest := filepath.Join(dir, "dest.txt")
+	writeTestFile(t, source, "moved")
+	writeTestFile(t, dest, "old")
+	err := os.Chmod(source, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useCrossDeviceRename(t)
+
+	err = MoveFile(source, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, dest) != "moved" {
+		t.Fatal("destination does not have the source contents")
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Fatalf("destination has mode %v, want 0640", info.Mode().Perm())
+	}
+	contents, err := GetDirContents(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, contents, []string{"dest.txt"})
+}
+
+func TestMoveFileCrossDeviceFailedCopy(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dest.txt")
+	writeTestFile(t, dest, "old")
+	useCrossDeviceRename(t)
+
+	// A missing source fails before anything is copied, a directory fails part way
+	// through reading it.
+	missing := filepath.Join(dir, "missing.txt")
+	unreadable := filepath.Join(dir, "unreadable")
+	err := os.Mkdir(unreadable, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range []string{missing, unreadable} {
+		err := MoveFile(source, dest)
+		if err == nil {
+			t.Fatalf("expected an error moving %s", source)
+		}
+		if readTestFile(t, dest) != "old" {
+			t.Fatalf("failed move of %s changed the existing destination", source)
+		}
+	}
+
+	exists, err := DirExists(unreadable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("source was removed after a failed copy")
+	}
+	contents, err := GetDirContents(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, contents, []string{"dest.txt", "unreadable"})
+}
+
+func TestMoveFileRenameError(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.txt")
+	writeTestFile(t, source, "source")
+	previous := rename
+	t.Cleanup(func() { rename = previous })
+	rename = func(oldPath string, newPath string) error {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.EACCES}
+	}
+
+	err := MoveFile(source, filepath.Join(dir, "dest.txt"))
+	if !errors.Is(err, syscall.EACCES) {
+		t.Fatalf("got %v, want EACCES", err)
+	}
+	_, err = os.Stat(filepath.Join(dir, "dest.txt"))
+	if !os.IsNotExist(err) {
+		t.Fatal("a rename error that is not cross device fell back to copying")
+	}
+}
+
+func TestMoveDirectoryCrossDevice(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	dest := filepath.Join(root, "dest")
+	writeTestFile(t, filepath.Join(source, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(source, "sub", "b.txt"), "b")
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	err := os.Chtimes(filepath.Join(source, "sub", "b.txt"), modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chmod(filepath.Join(source, "sub"), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useCrossDeviceRename(t)
+
+	err = MoveDirectory(source, dest, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTestFile(t, filepath.Join(dest, "a.txt")) != "a" || readTestFile(t, filepath.Join(dest, "sub", "b.txt")) != "b" {
+		t.Fatal("moved files have the wrong contents")
+	}
+	assertModTime(t, filepath.Join(dest, "sub", "b.txt"), modTime)
+	info, err := os.Stat(filepath.Join(dest, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0750 {
+		t.Fatalf("moved directory has mode %v, want 0750", info.Mode().Perm())
+	}
+	_, err = os.Stat(source)
+	if !os.IsNotExist(err) {
+		t.Fatalf("source still exists after the move: %v", err)
+	}
+}
+
+func TestMoveDirectoryCrossDeviceFailedCopy(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	writeTestFile(t, filepath.Join(source, "a.txt"), "a")
+	useCrossDeviceRename(t)
+
+	// The copy cannot create a destination whose parent is missing.
+	err := MoveDirectory(source, filepath.Join(root, "missing", "dest"), false)
+	if err == nil {
+		t.Fatal("expected an error when the copy fails")
+	}
+	if readTestFile(t, filepath.Join(source, "a.txt")) != "a" {
+		t.Fatal("source was removed after a failed copy")
+	}
+}
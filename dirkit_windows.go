@@ -0,0 +1,64 @@
+//go:build windows
+
+package dirkit
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// The line ending written by functions such as WriteLines.
+const lineEnding = "\r\n"
+
+// ERROR_NOT_SAME_DEVICE, returned by MoveFileEx when moving across volumes.
+const errorNotSameDevice syscall.Errno = 17
+
+// ERROR_SHARING_VIOLATION and ERROR_LOCK_VIOLATION, returned while another process
+// has a file open or locked.
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// Helper function for determining if an error came from moving across volumes.
+// Args:
+//
+//	err(error): The error returned from os.Rename.
+//
+// Returns:
+//
+//	bool: True if the error is a cross-volume error else false.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
+
+// Helper function for determining if a file has the Windows hidden attribute.
+// Args:
+//
+//	info(fs.FileInfo): The info of the file to check.
+//
+// Returns:
+//
+//	bool: True if the file has FILE_ATTRIBUTE_HIDDEN set else false.
+func hasHiddenAttribute(info fs.FileInfo) bool {
+	attributes, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return false
+	}
+	return attributes.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+}
+
+// Helper function for determining if an error is transient and worth retrying.
+// Args:
+//
+//	err(error): The error to check.
+//
+// Returns:
+//
+//	bool: True if the error is a sharing, lock, or access violation else false.
+func isRetryableError(err error) bool {
+	return errors.Is(err, errorSharingViolation) ||
+		errors.Is(err, errorLockViolation) ||
+		errors.Is(err, syscall.ERROR_ACCESS_DENIED)
+}